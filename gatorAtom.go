@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    atomText    `xml:"title"`
+	Subtitle atomText    `xml:"subtitle"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Summary    atomText       `xml:"summary"`
+	Content    atomText       `xml:"content"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// atomText covers text constructs (title, summary, content), which can be
+// plain text, escaped html or inline xhtml markup.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) value() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// html is the construct as markup, for summaries and content: plain text (the default
+// type) is escaped rather than passed on as html.
+func (t atomText) html() string {
+	switch t.Type {
+	case "html", "xhtml":
+		return t.value()
+	default:
+		return textToHTML(t.Text)
+	}
+}
+
+func parseAtom(data []byte) (*RSSFeed, error) {
+	var atom atomFeed
+	if err := newXMLDecoder(data).Decode(&atom); err != nil {
+		return &RSSFeed{}, err
+	}
+
+	rssfeed := &RSSFeed{}
+	rssfeed.Channel.Title = atom.Title.value()
+	rssfeed.Channel.Link = atomAlternateLink(atom.Links)
+	rssfeed.Channel.Description = atom.Subtitle.value()
+
+	for _, entry := range atom.Entries {
+		var item RSSItem
+		item.Title = entry.Title.value()
+		item.Link = atomAlternateLink(entry.Links)
+		item.GUID = RSSGUID{Value: entry.ID, IsPermaLink: "false"}
+
+		// summary is the short form; fall back to the full content when it's missing
+		item.Content = entry.Content.html()
+		item.Description = entry.Summary.html()
+		if item.Description == "" {
+			item.Description = item.Content
+		}
+
+		var authors []string
+		for _, author := range entry.Authors {
+			if name := strings.TrimSpace(author.Name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+		item.Creator = strings.Join(authors, ", ")
+
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Term)
+		}
+
+		// rel="enclosure" links are attachments such as podcast audio
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" {
+				item.Enclosures = append(item.Enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+			}
+		}
+
+		item.PubDate = entry.Published
+		if item.PubDate == "" {
+			item.PubDate = entry.Updated
+		}
+
+		rssfeed.Channel.Item = append(rssfeed.Channel.Item, item)
+	}
+
+	return rssfeed, nil
+}
+
+// atomAlternateLink picks the link pointing at the human-readable page: rel="alternate"
+// (the default when rel is missing), preferring html over other media types.
+func atomAlternateLink(links []atomLink) string {
+	alternate := ""
+	for _, link := range links {
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if link.Type == "" || link.Type == "text/html" {
+			return link.Href
+		}
+		if alternate == "" {
+			alternate = link.Href
+		}
+	}
+	return alternate
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// the encoding pseudo-attribute of an XML declaration, e.g. <?xml version="1.0" encoding="ISO-8859-1"?>
+var xmlDeclEncoding = regexp.MustCompile(`^<\?xml[^>]*?\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+)
+
+// feedToUTF8 converts an XML document to UTF-8. The encoding is taken from, in order:
+// a byte order mark, the XML declaration and the Content-Type charset. When the last two
+// disagree, UTF-8 wins if the bytes are valid UTF-8 (servers love to claim ISO-8859-1
+// for everything), and otherwise the document's own declaration does. With nothing to
+// go on, anything that isn't UTF-8 is read as Windows-1252, a superset of Latin-1.
+func feedToUTF8(data []byte, contentType string) []byte {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16BEBOM), bytes.HasPrefix(data, utf16LEBOM):
+		return decodeBytes(data, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM))
+	}
+
+	validUTF8 := utf8.Valid(data)
+	declared, declaredName := lookupCharset(declaredXMLEncoding(data))
+	served, servedName := lookupCharset(contentTypeCharset(contentType))
+
+	var enc encoding.Encoding
+	name := "" // canonical name of enc; charset.Lookup wraps encodings, so compare names, not values
+	switch {
+	case declared != nil && served != nil && declaredName != servedName:
+		switch {
+		case validUTF8 && (declaredName == "utf-8" || servedName == "utf-8"):
+			return data
+		case declaredName == "utf-8":
+			// the bytes aren't UTF-8, so the declaration is wrong; try the server's charset
+			enc, name = served, servedName
+		default:
+			enc, name = declared, declaredName
+		}
+	case declared != nil:
+		enc, name = declared, declaredName
+	case served != nil:
+		enc, name = served, servedName
+	case validUTF8:
+		return data
+	default:
+		enc = charmap.Windows1252
+	}
+
+	if name == "utf-8" {
+		if validUTF8 {
+			return data
+		}
+		// mislabelled; better to guess at the legacy encoding than to drop characters
+		enc = charmap.Windows1252
+	}
+	return decodeBytes(data, enc)
+}
+
+func decodeBytes(data []byte, enc encoding.Encoding) []byte {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return data // leave it to the parser to complain
+	}
+	return decoded
+}
+
+// lookupCharset resolves a charset label the way browsers do; nil when it's unknown.
+func lookupCharset(label string) (encoding.Encoding, string) {
+	if label == "" {
+		return nil, ""
+	}
+	return charset.Lookup(label)
+}
+
+func declaredXMLEncoding(data []byte) string {
+	match := xmlDeclEncoding.FindSubmatch(bytes.TrimLeft(data[:min(len(data), 1024)], " \t\r\n"))
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+func contentTypeCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(params["charset"])
+}
+
+// newXMLDecoder reads a document feedToUTF8 has already converted, so whatever
+// encoding the declaration still names is accepted as-is.
+func newXMLDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
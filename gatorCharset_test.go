@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestFeedToUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		want        string
+	}{
+		{"plain utf-8", `<rss>café</rss>`, "", `<rss>café</rss>`},
+		{"utf-8 bom", "\xEF\xBB\xBF<rss>café</rss>", "", `<rss>café</rss>`},
+		{"declared latin-1", `<?xml version="1.0" encoding="ISO-8859-1"?><rss>caf` + "\xe9</rss>", "", `<?xml version="1.0" encoding="ISO-8859-1"?><rss>café</rss>`},
+		{"served windows-1252", "<rss>\x93caf\xe9\x94</rss>", "text/xml; charset=windows-1252", `<rss>“café”</rss>`},
+		{"served koi8-r", "<rss>\xf0\xd2\xc9\xd7\xc5\xd4</rss>", "text/xml; charset=KOI8-R", `<rss>Привет</rss>`},
+		{"unlabelled latin-1", "<rss>caf\xe9</rss>", "", `<rss>café</rss>`},
+		{"declared utf-8 but latin-1 bytes", `<?xml version="1.0" encoding="UTF-8"?><rss>caf` + "\xe9</rss>", "", `<?xml version="1.0" encoding="UTF-8"?><rss>café</rss>`},
+		{"served utf-8 but latin-1 bytes", "<rss>caf\xe9</rss>", "application/rss+xml; charset=utf-8", `<rss>café</rss>`},
+		{"served latin-1 but utf-8 bytes", `<?xml version="1.0" encoding="UTF-8"?><rss>café</rss>`, "text/xml; charset=ISO-8859-1", `<?xml version="1.0" encoding="UTF-8"?><rss>café</rss>`},
+		{"declared utf-8, served koi8-r bytes", `<?xml version="1.0" encoding="utf-8"?><rss>` + "\xf0\xd2\xc9\xd7\xc5\xd4</rss>", "text/xml; charset=koi8-r", `<?xml version="1.0" encoding="utf-8"?><rss>Привет</rss>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(feedToUTF8([]byte(tt.data), tt.contentType))
+			if got != tt.want {
+				t.Errorf("feedToUTF8() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
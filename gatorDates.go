@@ -0,0 +1,166 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Feeds are supposed to use RFC 822 (RSS), RFC 3339 (Atom, JSON Feed) or W3CDTF (Dublin Core)
+// timestamps, but in the wild just about every variation shows up. Dates are normalized
+// (weekday dropped, named zones turned into offsets, punctuation squashed) and then
+// matched against a list of layouts.
+
+var feedDateLayouts = []string{
+	// RFC 3339 / W3CDTF, strictest first
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+
+	// RFC 822 / 1123 with the weekday already stripped
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 -07:00",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04 -0700",
+	"2 January 2006 15:04:05",
+	"2 January 2006",
+
+	// RFC 850 (obsolete, but still produced by old servers and PHP)
+	"02-Jan-06 15:04:05 -0700",
+	"02-Jan-2006 15:04:05 -0700",
+	"02-Jan-06 15:04:05",
+	"02-Jan-2006 15:04:05",
+
+	// month first (US style, ANSI C / Unix date)
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 15:04 -0700",
+	"Jan 2 15:04:05 -0700 2006",
+	"Jan 2 15:04:05 2006",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 2006",
+	"January 2 2006 15:04:05 -0700",
+	"January 2 2006",
+}
+
+// zone abbreviations commonly found in feeds; time.Parse would otherwise accept
+// them with a made-up zero offset
+var feedDateZones = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000", "WET": "+0000",
+	"EST": "-0500", "EDT": "-0400",
+	"CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600",
+	"PST": "-0800", "PDT": "-0700",
+	"AKST": "-0900", "AKDT": "-0800",
+	"HST": "-1000",
+	"BST": "+0100", "IST": "+0530", "WEST": "+0100",
+	"CET": "+0100", "CEST": "+0200", "MET": "+0100", "MEST": "+0200",
+	"EET": "+0200", "EEST": "+0300", "MSK": "+0300",
+	"SGT": "+0800", "HKT": "+0800", "AWST": "+0800",
+	"JST": "+0900", "KST": "+0900",
+	"ACST": "+0930", "ACDT": "+1030",
+	"AEST": "+1000", "AEDT": "+1100",
+	"NZST": "+1200", "NZDT": "+1300",
+}
+
+var feedDateMonths = map[string]bool{
+	"jan": true, "feb": true, "mar": true, "apr": true, "may": true, "jun": true,
+	"jul": true, "aug": true, "sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+var feedDateWeekdays = map[string]bool{
+	"mon": true, "tue": true, "tues": true, "wed": true, "thu": true, "thur": true, "thurs": true,
+	"fri": true, "sat": true, "sun": true,
+	"monday": true, "tuesday": true, "wednesday": true, "thursday": true,
+	"friday": true, "saturday": true, "sunday": true,
+}
+
+// trailing comments such as "+0000 (UTC)" or "GMT (Pacific)"
+var feedDateComment = regexp.MustCompile(`\s*\([^)]*\)\s*$`)
+
+// parseFeedDate reads a feed timestamp in any of the formats above. The returned
+// time is in UTC; ok is false when the value couldn't be understood at all.
+func parseFeedDate(raw string) (time.Time, bool) {
+	value := normalizeFeedDate(raw)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func normalizeFeedDate(raw string) string {
+	value := strings.TrimSpace(raw)
+	value = feedDateComment.ReplaceAllString(value, "")
+
+	// RFC 3339 style: uppercase the T/Z separators, leave everything else alone
+	// apart from a zone name written after the time ("2024-05-01 12:00:00 UTC")
+	if len(value) >= 10 && value[4] == '-' {
+		fields := strings.Fields(strings.ToUpper(value))
+		for i := 1; i < len(fields); i++ {
+			fields[i] = feedDateZone(fields[i])
+		}
+		return strings.Join(fields, " ")
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(value, ",", " "))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	if feedDateWeekdays[strings.ToLower(fields[0])] {
+		fields = fields[1:]
+	}
+
+	for i, field := range fields {
+		// "Oct." and "Sept." (the dot in "12:00:00.000" is a fraction and has to stay)
+		if month := strings.TrimSuffix(field, "."); feedDateMonths[strings.ToLower(month)] {
+			field = month
+		}
+		if strings.EqualFold(field, "Sept") {
+			field = "Sep"
+		}
+		fields[i] = feedDateZone(field)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// feedDateZone turns a zone name into an offset time.Parse understands: "GMT" becomes
+// "+0000" and "UTC-05:00" becomes "-05:00". Anything else is returned as is.
+func feedDateZone(field string) string {
+	upper := strings.ToUpper(field)
+	if offset, ok := feedDateZones[upper]; ok {
+		return offset
+	}
+	// "GMT+0100" / "UTC-05:00"
+	for _, prefix := range []string{"GMT", "UTC"} {
+		if strings.HasPrefix(upper, prefix+"+") || strings.HasPrefix(upper, prefix+"-") {
+			return field[len(prefix):]
+		}
+	}
+	return field
+}
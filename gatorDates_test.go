@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFeedDate(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string // RFC 3339 in UTC; empty when parsing should fail
+	}{
+		{"rfc 1123", "Wed, 02 Oct 2002 08:00:00 EST", "2002-10-02T13:00:00Z"},
+		{"rfc 1123 numeric zone", "Wed, 02 Oct 2002 13:00:00 +0000", "2002-10-02T13:00:00Z"},
+		{"rfc 822 two-digit year", "02 Oct 02 08:00:00 -0500", "2002-10-02T13:00:00Z"},
+		{"fractional seconds", "Wed, 02 Oct 2002 12:00:00.000 GMT", "2002-10-02T12:00:00Z"},
+		{"abbreviated month with dot", "Oct. 2, 2002", "2002-10-02T00:00:00Z"},
+		{"sept with dot", "2 Sept. 2002 08:00:00 GMT", "2002-09-02T08:00:00Z"},
+		{"rfc 850", "Wednesday, 02-Oct-02 08:00:00 EST", "2002-10-02T13:00:00Z"},
+		{"rfc 850 gmt", "Sunday, 06-Nov-94 08:49:37 GMT", "1994-11-06T08:49:37Z"},
+		{"zone comment", "Wed, 02 Oct 2002 08:00:00 -0500 (EST)", "2002-10-02T13:00:00Z"},
+		{"gmt offset", "Wed, 02 Oct 2002 09:00:00 GMT+0100", "2002-10-02T08:00:00Z"},
+		{"rfc 3339", "2002-10-02T08:00:00-05:00", "2002-10-02T13:00:00Z"},
+		{"rfc 3339 fractional", "2002-10-02t13:00:00.123z", "2002-10-02T13:00:00.123Z"},
+		{"iso with utc name", "2002-10-02 13:00:00 UTC", "2002-10-02T13:00:00Z"},
+		{"iso T with gmt name", "2002-10-02T13:00:00 GMT", "2002-10-02T13:00:00Z"},
+		{"iso with named zone", "2002-10-02 08:00:00 EST", "2002-10-02T13:00:00Z"},
+		{"date only", "2002-10-02", "2002-10-02T00:00:00Z"},
+		{"unix date", "Wed Oct 2 08:00:00 -0500 2002", "2002-10-02T13:00:00Z"},
+		{"empty", "   ", ""},
+		{"garbage", "last tuesday", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseFeedDate(tt.raw)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("parseFeedDate(%q) = %v, want failure", tt.raw, got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("parseFeedDate(%q) failed, want %s", tt.raw, tt.want)
+			}
+			if formatted := got.Format(time.RFC3339Nano); formatted != tt.want {
+				t.Errorf("parseFeedDate(%q) = %s, want %s", tt.raw, formatted, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// how long addfeed/follow may spend looking for a feed behind a URL
+const discoveryTimeout = 20 * time.Second
+
+// link types advertised with <link rel="alternate" type="..."> that point at feeds
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// places feeds usually live when a site doesn't advertise them
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/index.xml", "/atom.xml", "/feed.xml", "/rss", "/feed.json"}
+
+var errFeedUnreachable = errors.New("feed could not be fetched")
+
+type discoveredFeed struct {
+	URL  string
+	Feed *RSSFeed
+}
+
+// discoverFeed resolves a URL the user typed to an actual feed. Feed URLs are returned
+// as they are; for html pages the advertised feeds (or, failing that, the usual feed
+// paths) are tried, and the user is asked to pick when there is more than one.
+func discoverFeed(ctx context.Context, pageURL string) (discoveredFeed, error) {
+	data, contentType, finalURL, err := fetchPage(ctx, pageURL)
+	if err != nil {
+		return discoveredFeed{}, fmt.Errorf("%w: %v", errFeedUnreachable, err)
+	}
+
+	feed, parseErr := parseFeed(data, contentType)
+	if parseErr == nil {
+		return discoveredFeed{URL: pageURL, Feed: feed}, nil
+	}
+
+	if !isHTML(data, contentType) {
+		return discoveredFeed{}, fmt.Errorf("%s is not a parseable feed: %w", pageURL, parseErr)
+	}
+
+	var found []discoveredFeed
+	for _, candidate := range feedLinksInHTML(data, finalURL) {
+		if feed, err := fetchFeed(ctx, candidate); err == nil {
+			found = append(found, discoveredFeed{URL: candidate, Feed: feed})
+		}
+	}
+
+	if len(found) == 0 {
+		for _, candidate := range commonFeedCandidates(finalURL) {
+			if feed, err := fetchFeed(ctx, candidate); err == nil {
+				found = append(found, discoveredFeed{URL: candidate, Feed: feed})
+				break // one guessed feed is enough
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return discoveredFeed{}, fmt.Errorf("no feed found at %s", pageURL)
+	case 1:
+		fmt.Printf("Found feed %s\n", found[0].URL)
+		return found[0], nil
+	default:
+		return chooseFeed(found, os.Stdin, os.Stdout)
+	}
+}
+
+// fetchPage downloads url and also returns where redirects ended up, which is what
+// relative links in the page are resolved against.
+func fetchPage(ctx context.Context, pageURL string) ([]byte, string, *url.URL, error) {
+	req, err := newFeedRequest(ctx, pageURL)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	res, err := feedClient.Do(req)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error sending request: %w", fetchError(err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, "", nil, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+
+	data, err := readFeedBody(res)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return data, res.Header.Get("Content-Type"), res.Request.URL, nil
+}
+
+func isHTML(data []byte, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(data), "text/html")
+}
+
+// feedLinksInHTML collects <link rel="alternate"> feed URLs, resolved against the
+// page URL (or the page's <base href>).
+func feedLinksInHTML(data []byte, pageURL *url.URL) []string {
+	base := pageURL
+	seen := make(map[string]bool)
+	var links []string
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return links // io.EOF, or markup too broken to go on
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		switch token.Data {
+		case "base":
+			if href := htmlAttr(token, "href"); href != "" {
+				if resolved, err := pageURL.Parse(href); err == nil {
+					base = resolved
+				}
+			}
+		case "link":
+			if !hasRel(htmlAttr(token, "rel"), "alternate") {
+				continue
+			}
+			linkType := strings.ToLower(strings.TrimSpace(htmlAttr(token, "type")))
+			if !feedLinkTypes[linkType] {
+				continue
+			}
+			resolved, err := base.Parse(strings.TrimSpace(htmlAttr(token, "href")))
+			if err != nil || seen[resolved.String()] {
+				continue
+			}
+			seen[resolved.String()] = true
+			links = append(links, resolved.String())
+		case "body":
+			return links // feed links live in <head>
+		}
+	}
+}
+
+func commonFeedCandidates(pageURL *url.URL) []string {
+	var candidates []string
+	for _, path := range commonFeedPaths {
+		candidate := url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: path}
+		candidates = append(candidates, candidate.String())
+	}
+	return candidates
+}
+
+func htmlAttr(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// rel holds a space separated list of link types
+func hasRel(rel string, want string) bool {
+	for _, value := range strings.Fields(rel) {
+		if strings.EqualFold(value, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func chooseFeed(found []discoveredFeed, in io.Reader, out io.Writer) (discoveredFeed, error) {
+	fmt.Fprintln(out, "Several feeds were found:")
+	for i, candidate := range found {
+		fmt.Fprintf(out, " %d) %s - %s\n", i+1, candidate.Feed.Channel.Title, candidate.URL)
+	}
+	fmt.Fprintf(out, "Pick a feed [1-%d]: ", len(found))
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return discoveredFeed{}, fmt.Errorf("no feed picked; pass one of the urls above directly")
+	}
+
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(found) {
+		return discoveredFeed{}, fmt.Errorf("invalid choice: %s", strings.TrimSpace(line))
+	}
+	return found[choice-1], nil
+}
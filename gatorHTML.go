@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// Feed descriptions are html written by strangers. Before it's stored, html goes through
+// sanitizeHTML, which keeps an allowlist of formatting elements and attributes and drops
+// everything else; for the terminal, renderHTMLText turns it into wrapped plain text.
+
+// a line with nothing but whitespace on it, which separates paragraphs of plain text
+var blankLine = regexp.MustCompile(`\n[ \t\r]*\n`)
+
+// textToHTML turns a plain-text body into html: the text is escaped and each run of
+// lines between blank lines becomes a paragraph. Feeds mark bodies as text (Atom
+// type="text", JSON Feed content_text) and those must never be read as markup.
+func textToHTML(text string) string {
+	var out strings.Builder
+	for _, paragraph := range blankLine.Split(strings.ReplaceAll(text, "\r\n", "\n"), -1) {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			out.WriteString("<p>" + html.EscapeString(paragraph) + "</p>")
+		}
+	}
+	return out.String()
+}
+
+// elements kept by sanitizeHTML, with the attributes each may keep
+var allowedElements = map[string][]string{
+	"a": {"href", "title"}, "abbr": {"title"}, "b": nil, "blockquote": {"cite"}, "br": nil,
+	"caption": nil, "cite": nil, "code": nil, "dd": nil, "del": nil, "div": nil, "dl": nil,
+	"dt": nil, "em": nil, "figcaption": nil, "figure": nil, "h1": nil, "h2": nil, "h3": nil,
+	"h4": nil, "h5": nil, "h6": nil, "hr": nil, "i": nil, "img": {"src", "alt", "title", "width", "height"},
+	"ins": nil, "kbd": nil, "li": nil, "mark": nil, "ol": {"start"}, "p": nil, "pre": nil,
+	"q": {"cite"}, "s": nil, "small": nil, "span": nil, "strong": nil, "sub": nil, "sup": nil,
+	"table": nil, "tbody": nil, "td": {"colspan", "rowspan"}, "tfoot": nil, "th": {"colspan", "rowspan"},
+	"thead": nil, "time": {"datetime"}, "tr": nil, "u": nil, "ul": nil,
+}
+
+// elements dropped together with everything inside them
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "applet": true,
+	"noscript": true, "template": true, "textarea": true, "select": true, "title": true,
+	"svg": true, "math": true, "frameset": true, "noembed": true, "noframes": true,
+}
+
+// elements that never have content or an end tag
+var voidElements = map[string]bool{
+	"br": true, "hr": true, "img": true, "area": true, "base": true, "col": true, "embed": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true}
+
+// sanitizeHTML returns raw with only allowlisted elements and attributes left, links
+// restricted to http(s)/mailto or relative urls, and every element properly closed.
+// Relative urls are resolved against base (see htmlBaseURL) when there is one.
+func sanitizeHTML(raw string, base *url.URL) string {
+	var out strings.Builder
+	var open []string // allowed elements not closed yet
+	skipping := ""    // set while inside a dropped element
+	skipDepth := 0
+
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(raw))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			break // io.EOF; the tokenizer copes with anything else
+		}
+		token := tokenizer.Token()
+
+		if skipping != "" {
+			// nested tags of the same name (<svg><svg>) must all close before skipping stops
+			switch {
+			case tokenType == nethtml.StartTagToken && token.Data == skipping:
+				skipDepth++
+			case tokenType == nethtml.EndTagToken && token.Data == skipping:
+				skipDepth--
+				if skipDepth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		switch tokenType {
+		case nethtml.TextToken:
+			out.WriteString(html.EscapeString(token.Data))
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedElements[token.Data] {
+				if tokenType == nethtml.StartTagToken && !voidElements[token.Data] {
+					skipping, skipDepth = token.Data, 1
+				}
+				continue
+			}
+			allowedAttrs, ok := allowedElements[token.Data]
+			if !ok {
+				continue // unknown element: keep its text, lose the tag
+			}
+			out.WriteString(sanitizedStartTag(token, allowedAttrs, base))
+			if !voidElements[token.Data] && tokenType == nethtml.StartTagToken {
+				open = append(open, token.Data)
+			}
+		case nethtml.EndTagToken:
+			// close back to the matching element; stray end tags are dropped
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == token.Data {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+		// comments and doctypes are dropped
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return strings.TrimSpace(out.String())
+}
+
+func sanitizedStartTag(token nethtml.Token, allowedAttrs []string, base *url.URL) string {
+	var tag strings.Builder
+	tag.WriteString("<" + token.Data)
+	for _, attr := range token.Attr {
+		if attr.Namespace != "" || !containsString(allowedAttrs, attr.Key) {
+			continue
+		}
+		if urlAttributes[attr.Key] {
+			if !isSafeURL(attr.Val, token.Data == "a") {
+				continue
+			}
+			attr.Val = resolveHTMLURL(base, attr.Val)
+		}
+		fmt.Fprintf(&tag, ` %s="%s"`, attr.Key, html.EscapeString(attr.Val))
+	}
+	if token.Data == "a" {
+		tag.WriteString(` rel="nofollow noopener noreferrer"`)
+	}
+	tag.WriteString(">")
+	return tag.String()
+}
+
+// isSafeURL allows relative urls and http(s) ones (plus mailto for links); javascript:,
+// data: and friends are out. Browsers ignore whitespace and control characters inside
+// a scheme, so those are removed before looking at it.
+func isSafeURL(value string, isLink bool) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+
+	colon := strings.IndexByte(cleaned, ':')
+	if colon < 0 || strings.ContainsAny(cleaned[:colon], "/?#") {
+		return true // no scheme: relative
+	}
+	switch strings.ToLower(cleaned[:colon]) {
+	case "http", "https":
+		return true
+	case "mailto":
+		return isLink
+	default:
+		return false
+	}
+}
+
+// htmlBaseURL picks what relative urls in a post are resolved against: the first of
+// candidates (most specific first, e.g. post link, site url, feed url) that makes an
+// absolute http(s) url, with each candidate itself resolved against the ones after it.
+// nil when there's nothing usable.
+func htmlBaseURL(candidates ...string) *url.URL {
+	var base *url.URL
+	for i := len(candidates) - 1; i >= 0; i-- {
+		candidate := strings.TrimSpace(candidates[i])
+		if candidate == "" {
+			continue
+		}
+		ref, err := url.Parse(candidate)
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+		if ref.Scheme == "http" || ref.Scheme == "https" {
+			base = ref
+		}
+	}
+	return base
+}
+
+// resolveHTMLURL makes value absolute against base; values that are already absolute,
+// or can't be parsed, come back unchanged.
+func resolveHTMLURL(base *url.URL, value string) string {
+	if base == nil {
+		return value
+	}
+	ref, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return value
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// elements that start on a line of their own when rendered as text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "caption": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "figcaption": true, "figure": true,
+	"footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "tr": true, "ul": true,
+}
+
+// textWidth is how wide rendered text is wrapped: $COLUMNS when the shell exports it, else 80.
+func textWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns >= 20 {
+		return columns
+	}
+	return 80
+}
+
+// renderedBlock is a paragraph, list item or preformatted block of rendered text.
+type renderedBlock struct {
+	text   string
+	prefix string // list bullet or number, with the indentation of the list
+	pre    bool   // keep line breaks and spacing as they are
+}
+
+// renderHTMLText turns html into plain text wrapped to width: paragraphs and list items
+// on their own lines, links numbered like [1] with the urls, resolved against base,
+// listed at the end.
+func renderHTMLText(raw string, base *url.URL, width int) string {
+	var blocks []renderedBlock
+	var current strings.Builder
+	prefix := ""
+	var links []string
+	var openLinks []string // hrefs of the <a> elements we're inside
+	var lists []int        // one entry per open list: -1 for <ul>, the next number for <ol>
+	pre := 0
+	skipping := ""
+
+	flush := func() {
+		text := current.String()
+		current.Reset()
+		if pre > 0 {
+			if text = strings.Trim(text, "\n"); strings.TrimSpace(text) != "" {
+				blocks = append(blocks, renderedBlock{text: text, pre: true})
+			}
+		} else if text = strings.Join(strings.Fields(text), " "); text != "" {
+			blocks = append(blocks, renderedBlock{text: text, prefix: prefix})
+		}
+		prefix = ""
+	}
+
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(raw))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+
+		if skipping != "" {
+			if tokenType == nethtml.EndTagToken && token.Data == skipping {
+				skipping = ""
+			}
+			continue
+		}
+
+		switch tokenType {
+		case nethtml.TextToken:
+			current.WriteString(token.Data)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedElements[token.Data] {
+				if tokenType == nethtml.StartTagToken && !voidElements[token.Data] {
+					skipping = token.Data
+				}
+				continue
+			}
+			if blockElements[token.Data] || token.Data == "br" {
+				flush()
+			}
+			switch token.Data {
+			case "pre":
+				pre++
+			case "ul":
+				lists = append(lists, -1)
+			case "ol":
+				start := 1
+				if value, err := strconv.Atoi(htmlAttr(token, "start")); err == nil {
+					start = value
+				}
+				lists = append(lists, start)
+			case "li":
+				prefix = strings.Repeat("  ", max(len(lists)-1, 0)) + "* "
+				if len(lists) > 0 && lists[len(lists)-1] >= 0 {
+					prefix = fmt.Sprintf("%s%d. ", strings.Repeat("  ", len(lists)-1), lists[len(lists)-1])
+					lists[len(lists)-1]++
+				}
+			case "img":
+				if alt := strings.TrimSpace(htmlAttr(token, "alt")); alt != "" {
+					current.WriteString(" [image: " + alt + "] ")
+				}
+			case "a":
+				openLinks = append(openLinks, strings.TrimSpace(htmlAttr(token, "href")))
+			case "hr":
+				blocks = append(blocks, renderedBlock{text: strings.Repeat("-", min(width, 40))})
+			case "td", "th":
+				current.WriteString(" ")
+			}
+		case nethtml.EndTagToken:
+			switch token.Data {
+			case "a":
+				if len(openLinks) == 0 {
+					continue
+				}
+				href := openLinks[len(openLinks)-1]
+				openLinks = openLinks[:len(openLinks)-1]
+				if href != "" && !strings.HasPrefix(href, "#") {
+					links = append(links, resolveHTMLURL(base, href))
+					fmt.Fprintf(&current, " [%d]", len(links))
+				}
+			case "pre":
+				flush()
+				pre = max(pre-1, 0)
+			case "ul", "ol":
+				flush()
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			default:
+				if blockElements[token.Data] {
+					flush()
+				}
+			}
+		}
+	}
+	flush()
+
+	var out strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			// items of the same list go on consecutive lines, everything else gets a blank line
+			if block.prefix != "" && blocks[i-1].prefix != "" {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		if block.pre {
+			out.WriteString(block.text)
+		} else {
+			out.WriteString(wrapText(block.text, block.prefix, width))
+		}
+	}
+	if len(links) > 0 {
+		out.WriteString("\n")
+		for i, link := range links {
+			fmt.Fprintf(&out, "\n[%d] %s", i+1, link)
+		}
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces. The first
+// line starts with prefix; the rest are indented to line up under it.
+func wrapText(text string, prefix string, width int) string {
+	indent := strings.Repeat(" ", utf8.RuneCountInString(prefix))
+
+	var lines []string
+	line := prefix
+	lineHasWords := false
+	for _, word := range strings.Fields(text) {
+		switch {
+		case !lineHasWords:
+			line += word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width:
+			lines = append(lines, line)
+			line = indent + word
+		default:
+			line += " " + word
+		}
+		lineHasWords = true
+	}
+	if lineHasWords {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post.html")
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"allowed markup", `<p>Hello <b>world</b></p>`, `<p>Hello <b>world</b></p>`},
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"mixed case scheme", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"entity-encoded letter", `<a href="&#106;avascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"entity-encoded tab", `<a href="jav&#x09;ascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"entity-encoded newline", `<a href="java&#10;script:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"leading control characters", `<a href="&#1;&#32;javascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"entity-encoded colon", `<a href="javascript&colon;alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"data image", `<img src="data:image/svg+xml;base64,PHN2Zz4=" alt="a">`, `<img alt="a">`},
+		{"mailto only on links", `<a href="mailto:a@example.com">a</a><img src="mailto:a@example.com">`, `<a href="mailto:a@example.com" rel="nofollow noopener noreferrer">a</a><img>`},
+		{"event handlers", `<p onclick="alert(1)" style="color:red">x</p>`, `<p>x</p>`},
+		{"script", `a<script>alert("<b>")</script>b`, `ab`},
+		{"script inside svg", `<svg><script>alert(1)</script><text>hi</text></svg>after`, `after`},
+		{"nested svg", `<svg><svg></svg><a href="javascript:alert(1)">x</a></svg>after`, `after`},
+		{"unclosed script", `before<script>alert(1)`, `before`},
+		{"unclosed tags", `<p>one <b>two <i>three`, `<p>one <b>two <i>three</i></b></p>`},
+		{"misnested tags", `<b><i>x</b>y</i>`, `<b><i>x</i></b>y`},
+		{"stray end tag", `x</div></p>`, `x`},
+		{"unknown element keeps text", `<blink>hi</blink>`, `hi`},
+		{"escaped tags stay text", `<p>use &lt;div&gt; tags and 1 &lt; 2</p>`, `<p>use &lt;div&gt; tags and 1 &lt; 2</p>`},
+		{"text is escaped", `1 &lt; 2 &amp; "3"`, `1 &lt; 2 &amp; &#34;3&#34;`},
+		{"relative href", `<a href="../about">a</a>`, `<a href="https://example.com/about" rel="nofollow noopener noreferrer">a</a>`},
+		{"root-relative src", `<img src="/img/a.png">`, `<img src="https://example.com/img/a.png">`},
+		{"absolute href", `<a href="http://other.example/x">a</a>`, `<a href="http://other.example/x" rel="nofollow noopener noreferrer">a</a>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.raw, base); got != tt.want {
+				t.Errorf("sanitizeHTML(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "  \n ", ""},
+		{"one paragraph", "just text", "<p>just text</p>"},
+		{"markup-like text", "line one\n\nline two <3 a<b", "<p>line one</p><p>line two &lt;3 a&lt;b</p>"},
+		{"crlf and indented blank line", "one\r\n  \r\ntwo\nstill two", "<p>one</p><p>two\nstill two</p>"},
+		{"entities stay literal", "AT&amp;T", "<p>AT&amp;amp;T</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := textToHTML(tt.text); got != tt.want {
+				t.Errorf("textToHTML(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	// and it survives the trip through the sanitizer and renderer
+	text := "line one\n\nline two <3 a<b"
+	if got := renderHTMLText(sanitizeHTML(textToHTML(text), nil), nil, 80); got != "line one\n\nline two <3 a<b" {
+		t.Errorf("rendering %q gave %q", text, got)
+	}
+}
+
+func TestHTMLBaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"post link", []string{"https://example.com/post", "https://example.com/"}, "https://example.com/post"},
+		{"relative post link", []string{"/post", "https://example.com/blog/"}, "https://example.com/post"},
+		{"no post link", []string{"", "https://example.com/blog/"}, "https://example.com/blog/"},
+		{"relative site url", []string{"", "/", "https://example.com/feed.xml"}, "https://example.com/"},
+		{"not http", []string{"urn:uuid:1234", "https://example.com/"}, "https://example.com/"},
+		{"nothing usable", []string{"", "/relative"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if base := htmlBaseURL(tt.candidates...); base != nil {
+				got = base.String()
+			}
+			if got != tt.want {
+				t.Errorf("htmlBaseURL(%q) = %q, want %q", tt.candidates, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLText(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post.html")
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"paragraphs", `<p>one</p><p>two</p>`, "one\n\ntwo"},
+		{"list", `<ul><li>a</li><li>b</li></ul>`, "* a\n* b"},
+		{"ordered list", `<ol start="3"><li>a</li><li>b</li></ol>`, "3. a\n4. b"},
+		{"wrapping", `<p>aaaa bbbb cccc dddd</p>`, "aaaa bbbb\ncccc dddd"},
+		{"relative link", `<p>see <a href="other.html">x</a></p>`, "see x [1]\n\n[1] https://example.com/blog/other.html"},
+		{"fragment link", `<a href="#top">top</a>`, "top"},
+		{"script", `<p>a<script>b</script>c</p>`, "ac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderHTMLText(tt.raw, base, 10); got != tt.want {
+				t.Errorf("renderHTMLText(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
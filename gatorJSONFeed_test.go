@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseJSONFeedIDs(t *testing.T) {
+	data := `{
+		"version": "https://jsonfeed.org/version/1.1",
+		"title": "ids",
+		"items": [
+			{"id": "abc", "url": "https://example.com/a"},
+			{"id": 42, "url": "https://example.com/b"},
+			{"id": 1.5e3, "url": "https://example.com/c"},
+			{"id": "https://example.com/d"},
+			{"id": null, "url": "https://example.com/e"}
+		]
+	}`
+
+	feed, err := parseJSONFeed([]byte(data))
+	if err != nil {
+		t.Fatalf("parseJSONFeed() error: %v", err)
+	}
+
+	want := []struct{ guid, link string }{
+		{"abc", "https://example.com/a"},
+		{"42", "https://example.com/b"},
+		{"1.5e3", "https://example.com/c"},
+		{"https://example.com/d", "https://example.com/d"},
+		{"", "https://example.com/e"},
+	}
+	if len(feed.Channel.Item) != len(want) {
+		t.Fatalf("got %d items, want %d", len(feed.Channel.Item), len(want))
+	}
+	for i, item := range feed.Channel.Item {
+		if item.GUID.Value != want[i].guid || item.Link != want[i].link {
+			t.Errorf("item %d: guid %q, link %q; want %q, %q", i, item.GUID.Value, item.Link, want[i].guid, want[i].link)
+		}
+	}
+}
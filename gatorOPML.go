@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// OPML 1.0/2.0 subscription lists. Outlines with an xmlUrl are feeds; outlines
+// without one are folders, which can be nested.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+		OwnerName   string `xml:"ownerName,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlFeed is a feed outline flattened out of the tree, remembering the folders it was in.
+type opmlFeed struct {
+	Title   string
+	XMLURL  string
+	HTMLURL string
+	Folder  string // nested folders joined with "/"; empty at the top level
+}
+
+// folderSeparator joins nested OPML folder names into a single folder path.
+const folderSeparator = "/"
+
+func readOPML(path string) (opmlDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opmlDocument{}, err
+	}
+
+	var doc opmlDocument
+	if err := newXMLDecoder(feedToUTF8(data, "")).Decode(&doc); err != nil {
+		return opmlDocument{}, fmt.Errorf("error parsing opml: %w", err)
+	}
+	return doc, nil
+}
+
+func (doc opmlDocument) feeds() []opmlFeed {
+	return flattenOutlines(doc.Body.Outlines, nil)
+}
+
+func flattenOutlines(outlines []opmlOutline, folders []string) []opmlFeed {
+	var feeds []opmlFeed
+	for _, outline := range outlines {
+		title := strings.TrimSpace(outline.Title)
+		if title == "" {
+			title = strings.TrimSpace(outline.Text)
+		}
+
+		if outline.XMLURL != "" {
+			feeds = append(feeds, opmlFeed{
+				Title:   title,
+				XMLURL:  strings.TrimSpace(outline.XMLURL),
+				HTMLURL: strings.TrimSpace(outline.HTMLURL),
+				Folder:  strings.Join(folders, folderSeparator),
+			})
+		}
+
+		if len(outline.Outlines) > 0 {
+			// copy so sibling folders don't share (and overwrite) the same backing array
+			nested := append(append([]string{}, folders...), title)
+			feeds = append(feeds, flattenOutlines(outline.Outlines, nested)...)
+		}
+	}
+	return feeds
+}
+
+func newOPMLDocument(title string, owner string, feeds []opmlFeed) opmlDocument {
+	var doc opmlDocument
+	doc.Version = "2.0"
+	doc.Head.Title = title
+	doc.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+	doc.Head.OwnerName = owner
+	doc.Body.Outlines = buildOutlines(feeds)
+	return doc
+}
+
+// buildOutlines is the reverse of flattenOutlines: feeds sharing a folder path are
+// nested under folder outlines, which appear where their first feed did.
+func buildOutlines(feeds []opmlFeed) []opmlOutline {
+	var outlines []opmlOutline
+	folderIndex := make(map[string]int)
+	folderFeeds := make(map[string][]opmlFeed)
+
+	for _, feed := range feeds {
+		if feed.Folder == "" {
+			outlines = append(outlines, opmlOutline{
+				Text:    feed.Title,
+				Title:   feed.Title,
+				Type:    "rss",
+				XMLURL:  feed.XMLURL,
+				HTMLURL: feed.HTMLURL,
+			})
+			continue
+		}
+
+		folder, rest, _ := strings.Cut(feed.Folder, folderSeparator)
+		if _, exists := folderIndex[folder]; !exists {
+			folderIndex[folder] = len(outlines)
+			outlines = append(outlines, opmlOutline{Text: folder, Title: folder})
+		}
+		feed.Folder = rest
+		folderFeeds[folder] = append(folderFeeds[folder], feed)
+	}
+
+	for folder, index := range folderIndex {
+		outlines[index].Outlines = buildOutlines(folderFeeds[folder])
+	}
+	return outlines
+}
+
+func writeOPML(w io.Writer, doc opmlDocument) error {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gainax2k1/gator/internal/database"
+)
+
+// Podcast episodes are the audio/video enclosures of posts. They are downloaded into
+// <download_dir>/<feed name>/, first to a .part file that later runs resume from with
+// a Range request, and only renamed into place once the size and checksum check out.
+
+var errDownloadIncomplete = errors.New("download incomplete")
+
+// most episodes download/podcasts will consider in one go
+const maxEpisodes = 1000
+
+type downloadResult struct {
+	Path   string
+	Size   int64
+	SHA256 string // hex
+}
+
+// episodePath names an episode's file after its post: "2024-05-01 Episode title [1a2b3c4d].mp3".
+// The bracketed start of the enclosure's id keeps episodes with the same title and date
+// (or several enclosures of one post) from landing on the same file.
+func episodePath(dir string, episode database.GetEpisodesForUserRow) string {
+	folder := safeFileName(episode.FeedName)
+	if folder == "" {
+		folder = "podcast"
+	}
+
+	name := safeFileName(episode.PostTitle)
+	if name == "" {
+		name = episode.ID.String()
+	} else {
+		name += " [" + episode.ID.String()[:8] + "]"
+	}
+	if episode.PublishedAt.Valid {
+		name = episode.PublishedAt.Time.Format("2006-01-02") + " " + name
+	}
+	return filepath.Join(dir, folder, name+enclosureExtension(episode.Url, episode.MimeType.String))
+}
+
+// safeFileName drops characters that aren't allowed (or are awkward) in file names.
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	return strings.Trim(name, " .")
+}
+
+// enclosureExtension takes the extension from the url, or failing that from the media type.
+func enclosureExtension(enclosureURL string, mimeType string) string {
+	if parsed, err := url.Parse(enclosureURL); err == nil {
+		ext := path.Ext(parsed.Path)
+		if len(ext) > 1 && len(ext) <= 6 && isAlphanumeric(ext[1:]) {
+			return strings.ToLower(ext)
+		}
+	}
+	if extensions, err := mime.ExtensionsByType(mimeType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
+
+func isAlphanumeric(value string) bool {
+	for _, r := range value {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadEnclosure downloads enclosureURL to dest, resuming from dest.part if an earlier
+// run was interrupted. It goes through the same client and request setup as feeds, except
+// that there's no overall time limit: a download is only abandoned when it stalls.
+func downloadEnclosure(ctx context.Context, enclosureURL string, dest string) (downloadResult, error) {
+	partPath := dest + ".part"
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return downloadResult{}, err
+	}
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	req, err := newFeedRequest(ctx, enclosureURL)
+	if err != nil {
+		return downloadResult{}, err
+	}
+	req.Header.Set("Accept", "*/*")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := *feedClient
+	client.Timeout = 0 // episodes can take a long time; see stallReader
+	res, err := client.Do(req)
+	if err != nil {
+		return downloadResult{}, fmt.Errorf("error sending request: %w", fetchError(err))
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	var total int64 = -1 // size of the whole file, when the server says
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			os.Remove(partPath)
+			return downloadResult{}, fmt.Errorf("server resumed at the wrong offset (%q); the download will restart", res.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+		total = size
+	case http.StatusOK:
+		// a fresh download, or a server that ignores Range: start from scratch
+		offset = 0
+		flags |= os.O_TRUNC
+		total = res.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// nothing left past the offset: either the .part file is already complete,
+		// or the file changed on the server since it was started
+		_, size, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || size != offset {
+			os.Remove(partPath)
+			return downloadResult{}, fmt.Errorf("partial download no longer matches the file on the server; the download will restart")
+		}
+		return finishDownload(partPath, dest, res.Header)
+	default:
+		return downloadResult{}, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return downloadResult{}, err
+	}
+
+	body := newStallReader(res.Body, feedFetchLimits.ReadTimeout, cancel)
+	written, copyErr := io.Copy(file, body)
+	body.stop()
+	closeErr := file.Close()
+
+	if copyErr != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			copyErr = cause // stalled (ErrTimeout) or interrupted
+		}
+		return downloadResult{}, fmt.Errorf("%w after %d bytes (run download again to resume): %w", errDownloadIncomplete, offset+written, fetchError(copyErr))
+	}
+	if closeErr != nil {
+		return downloadResult{}, closeErr
+	}
+
+	size := offset + written
+	if total >= 0 && size < total {
+		return downloadResult{}, fmt.Errorf("%w: got %d of %d bytes (run download again to resume)", errDownloadIncomplete, size, total)
+	}
+	if total >= 0 && size > total {
+		os.Remove(partPath)
+		return downloadResult{}, fmt.Errorf("downloaded %d bytes but the file is %d bytes; the download will restart", size, total)
+	}
+
+	return finishDownload(partPath, dest, res.Header)
+}
+
+// finishDownload checks the finished .part file against the digest the server sent
+// (if any) and moves it into place.
+func finishDownload(partPath string, dest string, header http.Header) (downloadResult, error) {
+	size, sum, err := fileSHA256(partPath)
+	if err != nil {
+		return downloadResult{}, err
+	}
+
+	if want := representationDigest(header); want != "" && want != sum {
+		os.Remove(partPath)
+		return downloadResult{}, fmt.Errorf("checksum mismatch (expected sha-256 %s, got %s); the download will restart", want, sum)
+	}
+
+	if err := os.Rename(partPath, dest); err != nil {
+		return downloadResult{}, err
+	}
+	return downloadResult{Path: dest, Size: size, SHA256: sum}, nil
+}
+
+// existingDownload reuses an episode another user already downloaded to dest, as long as
+// the records show it was this enclosure and the file is still the one that was saved.
+// Anything else at dest is downloaded over.
+func existingDownload(s *state, episode database.GetEpisodesForUserRow, dest string) (downloadResult, bool, error) {
+	if _, err := os.Stat(dest); err != nil {
+		return downloadResult{}, false, nil
+	}
+
+	var lookup_params database.GetEpisodeDownloadParams
+	lookup_params.EnclosureID = episode.ID
+	lookup_params.FilePath = toNullString(dest)
+	recorded, err := s.db.GetEpisodeDownload(context.Background(), lookup_params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return downloadResult{}, false, nil
+	}
+	if err != nil {
+		return downloadResult{}, false, fmt.Errorf("error looking up downloads: %w", err)
+	}
+
+	size, sum, err := fileSHA256(dest)
+	if err != nil {
+		return downloadResult{}, false, fmt.Errorf("error reading %s: %w", dest, err)
+	}
+	if sum != recorded.Sha256.String {
+		return downloadResult{}, false, nil
+	}
+	return downloadResult{Path: dest, Size: size, SHA256: sum}, true, nil
+}
+
+func fileSHA256(filePath string) (int64, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parseContentRange reads "bytes 100-199/1000" (or "bytes */1000" on a 416); size is -1
+// when the server doesn't know the total.
+func parseContentRange(value string) (int64, int64, bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	byteRange, sizeText, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size := int64(-1)
+	if sizeText != "*" {
+		parsed, err := strconv.ParseInt(sizeText, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		size = parsed
+	}
+
+	if byteRange == "*" {
+		return 0, size, true
+	}
+	startText, _, found := strings.Cut(byteRange, "-")
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if !found || err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// representationDigest returns the sha-256 of the whole file as hex, from a Repr-Digest
+// (RFC 9530) or older Digest (RFC 3230) header; both describe the full file even on a
+// partial response. Empty when the server sends neither.
+func representationDigest(header http.Header) string {
+	for _, field := range strings.Split(header.Get("Repr-Digest"), ",") {
+		algorithm, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if found && strings.EqualFold(algorithm, "sha-256") {
+			if sum, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":")); err == nil {
+				return hex.EncodeToString(sum)
+			}
+		}
+	}
+	for _, field := range strings.Split(header.Get("Digest"), ",") {
+		algorithm, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if found && strings.EqualFold(algorithm, "sha-256") {
+			if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+				return hex.EncodeToString(sum)
+			}
+		}
+	}
+	return ""
+}
+
+// stallReader cancels a download that goes longer than timeout without receiving anything.
+type stallReader struct {
+	reader  io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newStallReader(reader io.Reader, timeout time.Duration, cancel context.CancelCauseFunc) *stallReader {
+	return &stallReader{
+		reader:  reader,
+		timeout: timeout,
+		timer:   time.AfterFunc(timeout, func() { cancel(ErrTimeout) }),
+	}
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *stallReader) stop() {
+	r.timer.Stop()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/xml"
+)
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// RSS 1.0 keeps its items next to the channel instead of inside it, and
+// borrows Dublin Core (dc:) elements for dates and authors.
+type rdfFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF"`
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Items []rdfItem `xml:"item"`
+}
+
+type rdfItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+func parseRDF(data []byte) (*RSSFeed, error) {
+	var rdf rdfFeed
+	if err := newXMLDecoder(data).Decode(&rdf); err != nil {
+		return &RSSFeed{}, err
+	}
+
+	rssfeed := &RSSFeed{}
+	rssfeed.Channel.Title = rdf.Channel.Title
+	rssfeed.Channel.Link = rdf.Channel.Link
+	rssfeed.Channel.Description = rdf.Channel.Description
+	rssfeed.Channel.UpdatePeriod = rdf.Channel.UpdatePeriod
+	rssfeed.Channel.UpdateFrequency = rdf.Channel.UpdateFrequency
+
+	for _, rdfitem := range rdf.Items {
+		var item RSSItem
+		item.Title = rdfitem.Title
+		item.Link = rdfitem.Link
+		if item.Link == "" {
+			item.Link = rdfitem.About // rdf:about is the item's URI
+		}
+		item.GUID = RSSGUID{Value: rdfitem.About, IsPermaLink: "false"}
+		item.Description = rdfitem.Description
+		item.PubDate = rdfitem.Date
+		item.Creator = rdfitem.Creator
+		item.Categories = rdfitem.Subjects
+		item.Content = rdfitem.Content
+
+		rssfeed.Channel.Item = append(rssfeed.Channel.Item, item)
+	}
+
+	return rssfeed, nil
+}
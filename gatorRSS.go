@@ -2,96 +2,624 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
 	"io"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gainax2k1/gator/internal/config"
+	"github.com/gainax2k1/gator/internal/database"
+	"github.com/google/uuid"
 )
 
+// RSSFeed is the common feed model: every supported format is mapped into it
+// so scrapeFeeds doesn't need to care where the items came from.
 type RSSFeed struct {
 	Channel struct {
 		Title       string    `xml:"title"`
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Item        []RSSItem `xml:"item"`
+
+		// publisher hints about how often to poll (see gatorSchedule.go)
+		TTL             string   `xml:"ttl"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	GUID        RSSGUID        `xml:"guid"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"` // full html body
+	Author      string         `xml:"author"`                                           // "email (Name)" in RSS 2.0
+	Categories  []string       `xml:"category"`
+	Comments    string         `xml:"comments"` // url of the item's comments page
+}
+
+// RSSGUID is the publisher's id for an item (Atom id, JSON Feed id, rdf:about for the
+// other formats). isPermaLink defaults to true, in which case it's also the item's url.
+type RSSGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// feedValidators are the cache headers a server handed out with the last full response.
+type feedValidators struct {
+	ETag         string
+	LastModified string
+}
+
+type fetchResult struct {
+	Feed        *RSSFeed
+	Validators  feedValidators
+	NotModified bool   // server answered 304; Feed is empty
+	MovedTo     string // set when the feed was redirected and every redirect was permanent (301/308)
 }
 
 func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	var rssfeed *RSSFeed = &RSSFeed{}
+	result, err := fetchFeedConditional(ctx, feedURL, feedValidators{})
+	return result.Feed, err
+}
+
+// Errors the aggregator records against a feed that is too big or too slow to fetch.
+var (
+	ErrFeedTooLarge = errors.New("response body too large")
+	ErrTimeout      = errors.New("request timed out")
+)
+
+// feedFetchLimits applies to every request gator makes; main replaces the defaults
+// with whatever the config file sets (see configureFetching).
+var feedFetchLimits = config.FetchLimits{
+	MaxBodySize:    config.DefaultMaxFeedSize,
+	ConnectTimeout: config.DefaultConnectTimeout,
+	ReadTimeout:    config.DefaultReadTimeout,
+	MaxRedirects:   config.DefaultMaxRedirects,
+}
+
+// feedClient is what every outgoing gator request goes through. All of them share one
+// transport, so connections to a server are reused and idle ones eventually closed.
+var feedClient = newFeedClient(feedFetchLimits)
+
+// how long an unused keep-alive connection is kept around
+const idleConnTimeout = 90 * time.Second
+
+// configureFetching swaps in the limits from the config file.
+func configureFetching(limits config.FetchLimits) {
+	feedFetchLimits = limits
+	feedClient = newFeedClient(limits)
+}
+
+func newFeedClient(limits config.FetchLimits) *http.Client {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: limits.ConnectTimeout}).DialContext,
+		TLSHandshakeTimeout:   limits.ConnectTimeout,
+		ResponseHeaderTimeout: limits.ReadTimeout,
+		IdleConnTimeout:       idleConnTimeout,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   limits.ConnectTimeout + limits.ReadTimeout, // covers reading the body too
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= limits.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", limits.MaxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// readFeedBody reads a response body, refusing anything over the size limit rather
+// than holding an endless or enormous response in memory.
+func readFeedBody(res *http.Response) ([]byte, error) {
+	maxSize := feedFetchLimits.MaxBodySize
+	if res.ContentLength > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrFeedTooLarge, res.ContentLength, maxSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", fetchError(err))
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrFeedTooLarge, maxSize)
+	}
+	return data, nil
+}
+
+// fetchError marks timeouts with ErrTimeout so callers can tell them apart from
+// other network failures. Cancellation (ctrl-c) is left alone.
+func fetchError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return err
+}
+
+// newFeedRequest builds the GET every outgoing gator request starts from.
+func newFeedRequest(ctx context.Context, url string) (*http.Request, error) {
 	var readerbody io.Reader
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, readerbody)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, readerbody)
 	if err != nil {
-		return rssfeed, err
+		return nil, err
 	}
 
 	req.Header.Set("User-Agent", "gator") // identify self to server
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	return req, nil
+}
+
+// fetchFeedConditional sends If-None-Match/If-Modified-Since when validators are known,
+// so unchanged feeds cost a 304 instead of a full download.
+func fetchFeedConditional(ctx context.Context, feedURL string, validators feedValidators) (fetchResult, error) {
+	result := fetchResult{Feed: &RSSFeed{}}
+
+	req, err := newFeedRequest(ctx, feedURL)
+	if err != nil {
+		return result, err
+	}
+
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
 
-	client := http.Client{}
+	// a feed that has moved for good should be fetched from its new home from now on,
+	// but one temporary hop anywhere in the chain means the old url stays authoritative.
+	// res.Request.URL is re-serialized even without a redirect ("HTTP://" comes back as
+	// "http://"), so only an actual redirect counts as a move.
+	redirected, permanent := false, true
+	client := *feedClient // a copy, so the redirect check below only applies to this request
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		redirected = true
+		status := req.Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			permanent = false
+		}
+		return checkRedirect(req, via)
+	}
 	res, err := client.Do(req)
 	if err != nil {
-		return rssfeed, fmt.Errorf("error sending request: %w", err)
+		return result, fmt.Errorf("error sending request: %w", fetchError(err))
 	}
 	defer res.Body.Close()
 
-	data, err := io.ReadAll(res.Body)
+	if finalURL := res.Request.URL.String(); redirected && permanent && finalURL != feedURL {
+		result.MovedTo = finalURL
+	}
+
+	result.Validators.ETag = res.Header.Get("ETag")
+	result.Validators.LastModified = res.Header.Get("Last-Modified")
+
+	if res.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return result, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
 
+	data, err := readFeedBody(res)
 	if err != nil {
-		return rssfeed, fmt.Errorf("error reading response body: %w", err)
+		return result, err
 	}
 
-	if err = xml.Unmarshal(data, rssfeed); err != nil {
-		return rssfeed, err
+	rssfeed, err := parseFeed(data, res.Header.Get("Content-Type"))
+	if err != nil {
+		return result, err
 	}
 
 	// CLEAN rssfeed HERE
+	// (item descriptions are html and are decoded once, by sanitizeHTML, when they're saved)
 	rssfeed.Channel.Title = html.UnescapeString(rssfeed.Channel.Title)
 	rssfeed.Channel.Description = html.UnescapeString((rssfeed.Channel.Description))
 	for i, rssitem := range rssfeed.Channel.Item {
 		rssfeed.Channel.Item[i].Title = html.UnescapeString((rssitem.Title))
-		rssfeed.Channel.Item[i].Description = html.UnescapeString((rssitem.Description))
 	}
 
+	result.Feed = rssfeed
+	return result, nil
+
+}
+
+// parseFeed picks a parser based on the content type and, for XML, the document's root element.
+func parseFeed(data []byte, contentType string) (*RSSFeed, error) {
+	if isJSONFeed(data, contentType) {
+		return parseJSONFeed(data)
+	}
+
+	data = feedToUTF8(data, contentType)
+	root, err := feedRootElement(data)
+	if err != nil {
+		return &RSSFeed{}, fmt.Errorf("error reading feed document: %w", err)
+	}
+
+	switch {
+	case root.Space == atomNamespace && root.Local == "feed":
+		return parseAtom(data)
+	case root.Local == "rss":
+		return parseRSS(data)
+	case root.Space == rdfNamespace && root.Local == "RDF":
+		return parseRDF(data)
+	default:
+		return &RSSFeed{}, fmt.Errorf("unsupported feed format: <%s>", root.Local)
+	}
+}
+
+func parseRSS(data []byte) (*RSSFeed, error) {
+	rssfeed := &RSSFeed{}
+	if err := newXMLDecoder(data).Decode(rssfeed); err != nil {
+		return rssfeed, err
+	}
+
+	// a permalink guid doubles as the link for items that don't have one
+	for i, item := range rssfeed.Channel.Item {
+		guid := strings.TrimSpace(item.GUID.Value)
+		if item.Link == "" && guid != "" && !strings.EqualFold(item.GUID.IsPermaLink, "false") {
+			rssfeed.Channel.Item[i].Link = guid
+		}
+	}
 	return rssfeed, nil
+}
+
+// feedRootElement returns the name of the first element in an XML document.
+func feedRootElement(data []byte) (xml.Name, error) {
+	decoder := newXMLDecoder(data)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// how long past the fetch timeout a claimed feed stays leased to the agg that claimed it
+const feedLeaseMargin = time.Minute
 
+// aggSettings are the knobs the agg command passes down to every scrape.
+type aggSettings struct {
+	concurrency int           // feeds fetched in parallel per tick
+	timeout     time.Duration // per-feed fetch timeout
+	minInterval time.Duration // bounds for adaptive polling, also used for retry backoff
+	maxInterval time.Duration
+	maxFailures int // failures in a row before a feed is disabled
 }
 
-func scrapeFeeds(s *state) error {
+// scrapeFeeds claims up to `concurrency` of the stalest (due) feeds and fetches them in parallel.
+// Claiming locks the rows (FOR UPDATE SKIP LOCKED) and leases them by pushing next_fetch_at past
+// the fetch, so several agg processes can share a database without fetching a feed twice.
+// A feed that fails is logged and has the error recorded against it; it never stops the others.
+// Cancelling ctx aborts in-flight fetches, but anything already fetched is still written.
+func scrapeFeeds(ctx context.Context, s *state, settings aggSettings) error {
 
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
+	// the lease covers the fetch plus time to save it; MarkFeedFetched or RecordFeedError
+	// then set the real next fetch, and a crashed agg's feeds come due again once it runs out
+	var claim_params database.GetNextFeedsToFetchParams
+	claim_params.LeaseSeconds = int32((settings.timeout + feedLeaseMargin) / time.Second)
+	claim_params.MaxFeeds = int32(settings.concurrency)
+
+	feeds, err := s.db.GetNextFeedsToFetch(ctx, claim_params)
 	if err != nil {
-		return fmt.Errorf("error getting next feed to fetch: %w", err)
+		return fmt.Errorf("error getting next feeds to fetch: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, feed := range feeds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := scrapeFeed(ctx, s, feed, settings)
+			if err != nil && ctx.Err() != nil {
+				// shutting down; being interrupted isn't the feed's fault
+				log.Printf("fetch of feed [%s] cancelled", feed.Name)
+				return
+			}
+			if err != nil {
+				recordFeedError(ctx, s, feed, err, settings)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// recordFeedError backs a failing feed off exponentially (minInterval, doubling up to
+// maxInterval) and disables it once it has failed maxFailures times in a row.
+func recordFeedError(ctx context.Context, s *state, feed database.Feed, scrapeErr error, settings aggSettings) {
+	log.Printf("error scraping feed [%s] (%s): %v", feed.Name, feed.Url, scrapeErr)
+
+	failures := int(feed.ConsecutiveFailures) + 1
+	retryDelay := settings.minInterval
+	for i := 1; i < failures && retryDelay < settings.maxInterval; i++ {
+		retryDelay *= 2
+	}
+	retryDelay = min(retryDelay, settings.maxInterval)
+
+	var error_params database.RecordFeedErrorParams
+	error_params.ID = feed.ID
+	error_params.LastError = toNullString(scrapeErr.Error())
+	error_params.RetryDelay = int32(retryDelay / time.Second)
+	error_params.Disable = failures >= settings.maxFailures
+
+	if error_params.Disable {
+		log.Printf("feed [%s] failed %d times in a row; disabling it (re-enable with enable-feed %s)", feed.Name, failures, feed.Url)
+	} else {
+		log.Printf("retrying feed [%s] in %v", feed.Name, retryDelay)
 	}
 
-	err = s.db.MarkFeedFetched(context.Background(), feed.ID)
+	err := s.db.RecordFeedError(context.WithoutCancel(ctx), error_params)
 	if err != nil {
-		return fmt.Errorf("error marking feed [%s] fetched: %w", feed.Name, err)
+		log.Printf("error recording failure for feed [%s]: %v", feed.Name, err)
 	}
+}
+
+func scrapeFeed(ctx context.Context, s *state, feed database.Feed, settings aggSettings) error {
+	fetchCtx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
 
-	RSSFeed, err := fetchFeed(context.Background(), feed.Url)
+	validators := feedValidators{ETag: feed.Etag.String, LastModified: feed.LastModified.String}
+	result, err := fetchFeedConditional(fetchCtx, feed.Url, validators)
 	if err != nil {
-		return fmt.Errorf("error fetching feed [%s]: %w", feed.Name, err)
+		// no need to mark it fetched; claiming the feed already moved it to the back of the rotation
+		return fmt.Errorf("error fetching feed: %w", err)
+	}
+
+	// once the feed is downloaded its writes are allowed to finish, even during shutdown
+	writeCtx := context.WithoutCancel(ctx)
+
+	var mark_params database.MarkFeedFetchedParams
+	mark_params.ID = feed.ID
+	mark_params.Etag = feed.Etag
+	mark_params.LastModified = feed.LastModified
+	mark_params.SiteUrl = feed.SiteUrl
+
+	if result.NotModified {
+		// a 304 may or may not repeat the validators; keep the old ones unless it does
+		if result.Validators.ETag != "" {
+			mark_params.Etag = toNullString(result.Validators.ETag)
+		}
+		if result.Validators.LastModified != "" {
+			mark_params.LastModified = toNullString(result.Validators.LastModified)
+		}
+		setFeedSchedule(&mark_params, feed, scheduleFromRow(feed), 0, settings)
+
+		err = s.db.MarkFeedFetched(writeCtx, mark_params)
+		if err != nil {
+			return fmt.Errorf("error marking feed fetched: %w", err)
+		}
+		fmt.Printf("Feed %s not modified since last fetch\n", feed.Name)
+		return moveFeed(writeCtx, s, feed, result.MovedTo)
 	}
+	RSSFeed := result.Feed
 
 	fmt.Printf("RSS Channel: %s\n", RSSFeed.Channel.Title)
-	fmt.Printf("Description: %s\n", RSSFeed.Channel.Description)
 
-	for _, rssitems := range RSSFeed.Channel.Item {
-		fmt.Printf("- Title: %s\n", rssitems.Title)
-		//fmt.Println(" - Link: %s", rssitems.Link)
-		//fmt.Println(" - Description: %s", rssitems.Description)
-		//fmt.Println(" - Published: %s", rssitems.PubDate)
+	newPosts := 0
+	for _, rssitem := range RSSFeed.Channel.Item {
+		var newPost database.UpsertPostParams
+		newPost.CreatedAt = time.Now()
+		newPost.UpdatedAt = time.Now()
+		newPost.Title = rssitem.Title
+		newPost.Url = rssitem.Link
+		base := htmlBaseURL(rssitem.Link, RSSFeed.Channel.Link, feed.Url)
+		newPost.Description = toNullString(sanitizeHTML(rssitem.Description, base))
+		newPost.PublishedAt = parsePubDate(rssitem.PubDate)
+		newPost.FeedID = feed.ID
+		newPost.Guid = itemIdentity(rssitem)
+		newPost.Content = toNullString(sanitizeHTML(rssitem.Content, base))
+		newPost.Author = toNullString(itemAuthor(rssitem))
+		newPost.Categories = itemCategories(rssitem)
+		newPost.CommentsUrl = toNullString(strings.TrimSpace(rssitem.Comments))
+
+		// a post seen before is updated in place when the publisher edited it
+		saved, err := s.db.UpsertPost(writeCtx, newPost)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // seen before and unchanged
+		}
+		if err != nil {
+			return fmt.Errorf("error saving post [%s]: %w", newPost.Guid, err)
+		}
+		if saved.Inserted && rssitem.Link != "" && newPost.Guid != rssitem.Link {
+			adoptedID, err := adoptLegacyPost(writeCtx, s, newPost, saved.ID)
+			if err != nil {
+				return fmt.Errorf("error saving post [%s]: %w", newPost.Guid, err)
+			}
+			if adoptedID != uuid.Nil {
+				saved.ID, saved.Inserted = adoptedID, false
+			}
+		}
+		if saved.Inserted {
+			newPosts++
+		}
 
+		for _, enclosure := range rssitem.Enclosures {
+			if strings.TrimSpace(enclosure.URL) == "" {
+				continue
+			}
+			var enclosure_params database.SaveEnclosureParams
+			enclosure_params.PostID = saved.ID
+			enclosure_params.Url = strings.TrimSpace(enclosure.URL)
+			enclosure_params.MimeType = toNullString(strings.TrimSpace(enclosure.Type))
+			enclosure_params.Length = sql.NullInt64{Int64: enclosure.Length, Valid: enclosure.Length > 0}
+			if err := s.db.SaveEnclosure(writeCtx, enclosure_params); err != nil {
+				return fmt.Errorf("error saving enclosure [%s]: %w", enclosure.URL, err)
+			}
+		}
 	}
 
-	return nil
+	mark_params.Etag = toNullString(result.Validators.ETag)
+	mark_params.LastModified = toNullString(result.Validators.LastModified)
+	if RSSFeed.Channel.Link != "" {
+		mark_params.SiteUrl = toNullString(RSSFeed.Channel.Link)
+	}
+	setFeedSchedule(&mark_params, feed, scheduleFromFeed(RSSFeed), newPosts, settings)
+	err = s.db.MarkFeedFetched(writeCtx, mark_params)
+	if err != nil {
+		return fmt.Errorf("error marking feed fetched: %w", err)
+	}
+	fmt.Printf("Collected %d items (%d new) from %s\n", len(RSSFeed.Channel.Item), newPosts, feed.Name)
+
+	return moveFeed(writeCtx, s, feed, result.MovedTo)
+}
+
+// moveFeed points a feed at the url it permanently redirected to. When that url is
+// already a feed of its own, the followers and posts are handed over and the old feed is dropped.
+func moveFeed(ctx context.Context, s *state, feed database.Feed, newURL string) error {
+	if newURL == "" {
+		return nil
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error moving feed: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	existingID, err := qtx.GetFeedIDbyURL(ctx, newURL)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = qtx.UpdateFeedURL(ctx, database.UpdateFeedURLParams{ID: feed.ID, Url: newURL})
+		if err != nil {
+			return fmt.Errorf("error updating feed url: %w", err)
+		}
+		log.Printf("Feed %s moved permanently: %s -> %s", feed.Name, feed.Url, newURL)
+	case err != nil:
+		return fmt.Errorf("error looking up feed %s: %w", newURL, err)
+	default:
+		merge_params := database.MergeFeedFollowsParams{ToFeedID: existingID, FromFeedID: feed.ID}
+		if err := qtx.MergeFeedFollows(ctx, merge_params); err != nil {
+			return fmt.Errorf("error merging feed follows: %w", err)
+		}
+		// posts the other feed already has are deleted along with this feed; the rest
+		// move over with their enclosures and everyone's episode downloads
+		posts_params := database.MovePostsToFeedParams{ToFeedID: existingID, FromFeedID: feed.ID}
+		if err := qtx.MovePostsToFeed(ctx, posts_params); err != nil {
+			return fmt.Errorf("error moving posts: %w", err)
+		}
+		previous_params := database.SetFeedPreviousURLParams{ID: existingID, PreviousUrl: toNullString(feed.Url)}
+		if err := qtx.SetFeedPreviousURL(ctx, previous_params); err != nil {
+			return fmt.Errorf("error updating feed url: %w", err)
+		}
+		if err := qtx.DeleteFeed(ctx, feed.ID); err != nil {
+			return fmt.Errorf("error deleting feed: %w", err)
+		}
+		log.Printf("Feed %s moved permanently to %s, which is already a feed; merged into it", feed.Name, newURL)
+	}
+
+	return tx.Commit()
+}
+
+// adoptLegacyPost handles a post that looks new but may have been saved before items had
+// ids, when posts were keyed by their url. If so, the row just inserted is dropped and the
+// old one takes the item's id and contents, keeping its enclosures and downloads. Returns
+// the old post's id, or uuid.Nil when there is none. Only new posts need checking, so this
+// stays off the path of items seen before.
+func adoptLegacyPost(ctx context.Context, s *state, post database.UpsertPostParams, insertedID uuid.UUID) (uuid.UUID, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	if err := qtx.DeletePost(ctx, insertedID); err != nil {
+		return uuid.Nil, err
+	}
+	adopt_params := database.AdoptLegacyPostGUIDParams{Guid: post.Guid, FeedID: post.FeedID, Url: post.Url}
+	legacyID, err := qtx.AdoptLegacyPostGUID(ctx, adopt_params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil // really new; the rollback brings the inserted row back
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	// bring the old row up to date; no rows back just means nothing changed
+	if _, err := qtx.UpsertPost(ctx, post); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, err
+	}
+	return legacyID, tx.Commit()
+}
+
+func toNullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// itemIdentity is what tells one post of a feed from another across fetches: the
+// publisher's guid/id when there is one, else a hash of the title, link and date.
+func itemIdentity(item RSSItem) string {
+	if guid := strings.TrimSpace(item.GUID.Value); guid != "" {
+		return guid
+	}
+	sum := sha256.Sum256([]byte(item.Title + "\n" + item.Link + "\n" + item.PubDate))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// itemAuthor prefers dc:creator, which is a name, over RSS <author>, which is meant to
+// be an email address; for "jane@example.com (Jane Doe)" just the name is kept.
+func itemAuthor(item RSSItem) string {
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
+	}
+	author := strings.TrimSpace(item.Author)
+	if open := strings.Index(author, "("); open > 0 && strings.HasSuffix(author, ")") {
+		if name := strings.TrimSpace(author[open+1 : len(author)-1]); name != "" {
+			return name
+		}
+	}
+	return author
+}
+
+// itemCategories trims the item's categories and drops empty and repeated ones.
+func itemCategories(item RSSItem) []string {
+	categories := []string{}
+	seen := make(map[string]bool)
+	for _, category := range item.Categories {
+		category = strings.TrimSpace(category)
+		if category == "" || seen[strings.ToLower(category)] {
+			continue
+		}
+		seen[strings.ToLower(category)] = true
+		categories = append(categories, category)
+	}
+	return categories
+}
+
+// parsePubDate turns a feed's publish date into a nullable timestamp; NULL when it can't be read.
+func parsePubDate(pubDate string) sql.NullTime {
+	t, ok := parseFeedDate(pubDate)
+	return sql.NullTime{Time: t, Valid: ok}
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gainax2k1/gator/internal/database"
+)
+
+// feedSchedule holds the polling hints a publisher puts in its feed: RSS <ttl>,
+// <skipHours> and <skipDays>, or the syndication module's sy:updatePeriod.
+type feedSchedule struct {
+	TTL       time.Duration // zero when the feed doesn't say
+	SkipHours int32         // bit n set: don't fetch during hour n (GMT)
+	SkipDays  int32         // bit n set: don't fetch on time.Weekday(n) (GMT)
+}
+
+var syndicationPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+var skipDayNames = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func scheduleFromFeed(rssfeed *RSSFeed) feedSchedule {
+	var sched feedSchedule
+	channel := rssfeed.Channel
+
+	// <ttl> is in minutes
+	if minutes, err := strconv.Atoi(strings.TrimSpace(channel.TTL)); err == nil && minutes > 0 {
+		sched.TTL = time.Duration(minutes) * time.Minute
+	} else if period, ok := syndicationPeriods[strings.ToLower(strings.TrimSpace(channel.UpdatePeriod))]; ok {
+		// sy:updateFrequency is how many times per period, 1 when missing
+		frequency, err := strconv.Atoi(strings.TrimSpace(channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		sched.TTL = period / time.Duration(frequency)
+	}
+
+	for _, hour := range channel.SkipHours {
+		h, err := strconv.Atoi(strings.TrimSpace(hour))
+		if err != nil || h < 0 || h > 24 {
+			continue
+		}
+		sched.SkipHours |= 1 << (h % 24) // some feeds count midnight as 24
+	}
+	for _, day := range channel.SkipDays {
+		if weekday, ok := skipDayNames[strings.ToLower(strings.TrimSpace(day))]; ok {
+			sched.SkipDays |= 1 << weekday
+		}
+	}
+
+	return sched
+}
+
+// scheduleFromRow rebuilds the schedule stored at the last full fetch, for when
+// the server answers 304 and there's no document to read it from.
+func scheduleFromRow(feed database.Feed) feedSchedule {
+	return feedSchedule{
+		TTL:       time.Duration(feed.TtlSeconds.Int32) * time.Second,
+		SkipHours: feed.SkipHours,
+		SkipDays:  feed.SkipDays,
+	}
+}
+
+// fetchInterval is how long to wait between fetches of a feed: the interval set
+// with set-interval wins; otherwise the learned interval, but never below the publisher's ttl.
+func fetchInterval(feed database.Feed, sched feedSchedule, adaptive time.Duration) time.Duration {
+	if feed.FetchIntervalSeconds.Valid {
+		return time.Duration(feed.FetchIntervalSeconds.Int32) * time.Second
+	}
+	return max(sched.TTL, adaptive)
+}
+
+// adaptiveInterval learns how often a feed publishes: every fetch that turns up new
+// posts halves the interval, every fetch that doesn't stretches it by half again.
+// Busy feeds settle near the minimum, dormant ones drift out to the maximum.
+func adaptiveInterval(feed database.Feed, newPosts int, settings aggSettings) time.Duration {
+	interval := settings.minInterval // new feeds start out polled as often as allowed
+	if feed.AdaptiveIntervalSeconds.Valid {
+		interval = time.Duration(feed.AdaptiveIntervalSeconds.Int32) * time.Second
+	}
+
+	if newPosts > 0 {
+		interval /= 2
+	} else {
+		interval = interval * 3 / 2
+	}
+	return min(max(interval, settings.minInterval), settings.maxInterval)
+}
+
+// nextFetchDelay waits out the interval and then moves past any skipped hours or days.
+func nextFetchDelay(now time.Time, interval time.Duration, sched feedSchedule) time.Duration {
+	now = now.UTC()
+	next := now.Add(interval)
+
+	// a week of hours covers every combination; a feed skipping all of them is polled anyway
+	for i := 0; i < 7*24 && sched.skips(next); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next.Sub(now)
+}
+
+func (sched feedSchedule) skips(t time.Time) bool {
+	return sched.SkipHours&(1<<t.Hour()) != 0 || sched.SkipDays&(1<<t.Weekday()) != 0
+}
+
+// setFeedSchedule fills in the schedule columns MarkFeedFetched stores.
+func setFeedSchedule(params *database.MarkFeedFetchedParams, feed database.Feed, sched feedSchedule, newPosts int, settings aggSettings) {
+	params.TtlSeconds.Int32 = int32(sched.TTL / time.Second)
+	params.TtlSeconds.Valid = sched.TTL > 0
+	params.SkipHours = sched.SkipHours
+	params.SkipDays = sched.SkipDays
+
+	adaptive := adaptiveInterval(feed, newPosts, settings)
+	params.AdaptiveIntervalSeconds.Int32 = int32(adaptive / time.Second)
+	params.AdaptiveIntervalSeconds.Valid = true
+
+	delay := nextFetchDelay(time.Now(), fetchInterval(feed, sched, adaptive), sched)
+	params.NextFetchDelay = int32(delay / time.Second)
+}
@@ -2,17 +2,30 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gainax2k1/gator/internal/config"
 	"github.com/gainax2k1/gator/internal/database"
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
 type state struct {
 	db       *database.Queries
+	conn     *sql.DB // for the few writes that need a transaction
 	appState *config.Config
 }
 
@@ -44,6 +57,24 @@ func (c *commands) register(name string, f func(*state, command) error) { // Thi
 	c.cliCommands[name] = f
 }
 
+// parseFlags lets flags appear anywhere among a command's arguments (the flag package
+// stops at the first positional one) and returns the positional arguments in order.
+func parseFlags(flags *flag.FlagSet, arguments []string) ([]string, error) {
+	flags.SetOutput(io.Discard) // errors are returned to main instead of printed
+	var positional []string
+	for {
+		if err := flags.Parse(arguments); err != nil {
+			return nil, err
+		}
+		arguments = flags.Args()
+		if len(arguments) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, arguments[0])
+		arguments = arguments[1:]
+	}
+}
+
 func users(s *state, cmd command) error {
 	usernames, err := s.db.GetUsers(context.Background())
 	if err != nil {
@@ -137,7 +168,6 @@ func handlerReset(s *state, cmd command) error {
 	if err != nil {
 		fmt.Println("error reseting databse: ", err)
 		return err
-		os.Exit(1) //maybe overkill? maybe just return err?
 	}
 	fmt.Println("successfully reset database.")
 	os.Exit(0)
@@ -147,35 +177,78 @@ func handlerReset(s *state, cmd command) error {
 func handlerAgg(s *state, cmd command) error { //pdate the agg command to now take a single argument: time_between_reqs.
 	//url := "https://www.wagslane.dev/index.xml"
 
-	if len(cmd.arguments) != 1 {
-		return fmt.Errorf("Agg hander expects one argument <duration string>")
+	aggFlags := flag.NewFlagSet("agg", flag.ContinueOnError)
+	concurrency := aggFlags.Int("concurrency", 1, "number of feeds to fetch in parallel each tick")
+	timeout := aggFlags.Duration("timeout", 30*time.Second, "timeout for fetching a single feed")
+
+	arguments, err := parseFlags(aggFlags, cmd.arguments)
+	if err != nil {
+		return fmt.Errorf("error parsing agg options: %w", err)
+	}
+
+	if len(arguments) != 1 {
+		return fmt.Errorf("Agg hander expects one argument <duration string> [--concurrency N] [--timeout duration]")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got: %d", *concurrency)
+	}
+	if *timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got: %s", *timeout)
 	}
 
-	time_between_reqs, err := time.ParseDuration(cmd.arguments[0])
+	time_between_reqs, err := time.ParseDuration(arguments[0])
 	if err != nil {
 		return fmt.Errorf("error parsing time between reqs: %w", err)
 	}
 
-	// Create a context with  timeout in seconds, instead of just background
-	//ctx, cancel := context.WithTimeout(context.Background(), time_between_reqs)
-	//defer cancel()
-	fmt.Printf("Collecting feeds every %v\n", time_between_reqs)
+	minInterval, maxInterval, err := s.appState.FetchIntervalBounds()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	settings := aggSettings{
+		concurrency: *concurrency,
+		timeout:     *timeout,
+		minInterval: minInterval,
+		maxInterval: maxInterval,
+		maxFailures: s.appState.FeedFailureLimit(),
+	}
+
+	// stop cleanly on ctrl-c, or when systemd / a container runtime sends SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Collecting feeds every %v (%d at a time)\n", time_between_reqs, *concurrency)
 
 	ticker := time.NewTicker(time_between_reqs)
-	for ; ; <-ticker.C {
-		err = scrapeFeeds(s)
-		if err != nil {
-			return fmt.Errorf("error scraping feeds: %w", err)
+	defer ticker.Stop()
+	for {
+		err = scrapeFeeds(ctx, s, settings)
+		if err != nil && ctx.Err() == nil {
+			// most likely the database is briefly unavailable; try again next tick
+			log.Printf("error scraping feeds: %v", err)
 		}
-	}
 
-	return nil
+		select {
+		case <-ctx.Done():
+			fmt.Println("Shutting down aggregator.")
+			return nil
+		case <-ticker.C:
+		}
+	}
 }
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
 
-	if len(cmd.arguments) < 2 {
-		return fmt.Errorf("add feed handler expects two arguments (<name of feed> <url>); missing one or both ")
+	addFeedFlags := flag.NewFlagSet("addfeed", flag.ContinueOnError)
+	noVerify := addFeedFlags.Bool("no-verify", false, "add the feed without fetching it first (for feeds that are temporarily down)")
+
+	arguments, err := parseFlags(addFeedFlags, cmd.arguments)
+	if err != nil {
+		return fmt.Errorf("error parsing addfeed options: %w", err)
+	}
+
+	if len(arguments) < 1 || len(arguments) > 2 {
+		return fmt.Errorf("add feed handler expects [<name of feed>] <url> [--no-verify]; the name defaults to the feed's title")
 	}
 
 	/* This is now handled by middlware and "user" record is pased in now
@@ -188,8 +261,39 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 
 	var newFeed database.CreateFeedParams
 
-	newFeed.Name = cmd.arguments[0]
-	newFeed.Url = cmd.arguments[1]
+	newFeed.Url = arguments[0]
+	if len(arguments) == 2 {
+		newFeed.Name = arguments[0]
+		newFeed.Url = arguments[1]
+	}
+
+	if *noVerify {
+		if newFeed.Name == "" {
+			return fmt.Errorf("a feed name is required with --no-verify: addfeed <name of feed> <url> --no-verify")
+		}
+	} else {
+		// fetch it first so typos and dead links never make it into the aggregator's rotation;
+		// the url may also be a website rather than a feed, in which case its feed is looked up
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		defer cancel()
+		discovered, err := discoverFeed(ctx, newFeed.Url)
+		if errors.Is(err, errFeedUnreachable) {
+			return fmt.Errorf("%w (use --no-verify to add it anyway)", err)
+		}
+		if err != nil {
+			return fmt.Errorf("not adding feed: %w", err)
+		}
+
+		newFeed.Url = discovered.URL
+		newFeed.SiteUrl = toNullString(discovered.Feed.Channel.Link)
+		if newFeed.Name == "" {
+			newFeed.Name = discovered.Feed.Channel.Title
+		}
+		if newFeed.Name == "" {
+			newFeed.Name = discovered.URL
+		}
+	}
+
 	newFeed.CreatedAt = time.Now()
 	newFeed.UpdatedAt = time.Now()
 	newFeed.UserID = user.ID
@@ -225,6 +329,21 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 }
 
 func handlerFeeds(s *state, cmd command) error {
+	feedsFlags := flag.NewFlagSet("feeds", flag.ContinueOnError)
+	onlyErrors := feedsFlags.Bool("errors", false, "only show feeds whose last fetch failed")
+	onlyDisabled := feedsFlags.Bool("disabled", false, "only show feeds disabled after failing too often")
+
+	if _, err := parseFlags(feedsFlags, cmd.arguments); err != nil {
+		return fmt.Errorf("error parsing feeds options: %w", err)
+	}
+
+	if *onlyErrors {
+		return printFeedErrors(s)
+	}
+	if *onlyDisabled {
+		return printDisabledFeeds(s)
+	}
+
 	feeds, err := s.db.GetFeeds(context.Background())
 	if err != nil {
 		return err
@@ -242,7 +361,19 @@ func handlerFeeds(s *state, cmd command) error {
 
 		fmt.Printf("Feed name: %s\n", feed.Name)
 		fmt.Printf("URL: %s\n", feed.Url)
+		if feed.PreviousUrl.Valid {
+			fmt.Printf("Moved from: %s\n", feed.PreviousUrl.String)
+		}
 		fmt.Printf("By User: %s\n", user.Name)
+		fmt.Printf("Fetch interval: %s\n", describeFetchInterval(feed))
+		if feed.NextFetchAt.Valid {
+			fmt.Printf("Next fetch: %s\n", feed.NextFetchAt.Time.Format("Mon Jan 2 2006 15:04"))
+		}
+		if feed.DisabledAt.Valid {
+			fmt.Printf("Disabled: since %s (see feeds --disabled)\n", feed.DisabledAt.Time.Format("Mon Jan 2 2006 15:04"))
+		} else if feed.ConsecutiveFailures > 0 {
+			fmt.Printf("Failing: %d times in a row (see feeds --errors)\n", feed.ConsecutiveFailures)
+		}
 	}
 
 	return nil
@@ -255,6 +386,124 @@ func handlerFeeds(s *state, cmd command) error {
 	*/
 }
 
+func printDisabledFeeds(s *state) error {
+	feeds, err := s.db.GetDisabledFeeds(context.Background())
+	if err != nil {
+		return fmt.Errorf("error retrieving disabled feeds: %w", err)
+	}
+
+	if len(feeds) == 0 {
+		fmt.Println("No disabled feeds.")
+		return nil
+	}
+
+	for _, feed := range feeds {
+		fmt.Printf("Feed name: %s\n", feed.Name)
+		fmt.Printf("URL: %s\n", feed.Url)
+		fmt.Printf("Disabled: %s, after %d failures in a row\n", feed.DisabledAt.Time.Format("Mon Jan 2 2006 15:04"), feed.ConsecutiveFailures)
+		fmt.Printf("Last error: %s\n\n", feed.LastError.String)
+	}
+	fmt.Println("Re-enable a feed with: enable-feed <url>")
+	return nil
+}
+
+func handlerEnableFeed(s *state, cmd command) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("enable-feed handler expects one argument <url>")
+	}
+
+	updated, err := s.db.EnableFeed(context.Background(), cmd.arguments[0])
+	if err != nil {
+		return fmt.Errorf("error enabling feed: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("no feed found with url %s", cmd.arguments[0])
+	}
+
+	fmt.Printf("Feed %s enabled; it will be fetched on the next agg tick\n", cmd.arguments[0])
+	return nil
+}
+
+func describeFetchInterval(feed database.Feed) string {
+	override := time.Duration(feed.FetchIntervalSeconds.Int32) * time.Second
+	ttl := time.Duration(feed.TtlSeconds.Int32) * time.Second
+	adaptive := time.Duration(feed.AdaptiveIntervalSeconds.Int32) * time.Second
+
+	switch {
+	case feed.FetchIntervalSeconds.Valid:
+		return fmt.Sprintf("%v (set with set-interval)", override)
+	case feed.TtlSeconds.Valid && ttl > adaptive:
+		return fmt.Sprintf("%v (from the feed's ttl)", ttl)
+	case feed.AdaptiveIntervalSeconds.Valid:
+		return fmt.Sprintf("%v (adapted to how often it posts)", adaptive)
+	default:
+		return "not learned yet"
+	}
+}
+
+func handlerSetInterval(s *state, cmd command) error {
+	if len(cmd.arguments) != 2 {
+		return fmt.Errorf("set-interval handler expects two arguments <url> <duration|auto>")
+	}
+
+	var interval_params database.SetFeedFetchIntervalParams
+	interval_params.Url = cmd.arguments[0]
+
+	// "auto" hands scheduling back to the feed's own hints
+	if cmd.arguments[1] != "auto" {
+		interval, err := time.ParseDuration(cmd.arguments[1])
+		if err != nil {
+			return fmt.Errorf("error parsing interval: %w", err)
+		}
+		if interval < time.Second {
+			return fmt.Errorf("interval must be at least one second, got: %v", interval)
+		}
+		if interval/time.Second > math.MaxInt32 {
+			return fmt.Errorf("interval is too long, got: %v (max %v)", interval, time.Duration(math.MaxInt32)*time.Second)
+		}
+		interval_params.FetchIntervalSeconds.Int32 = int32(interval / time.Second)
+		interval_params.FetchIntervalSeconds.Valid = true
+	}
+
+	updated, err := s.db.SetFeedFetchInterval(context.Background(), interval_params)
+	if err != nil {
+		return fmt.Errorf("error setting fetch interval: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("no feed found with url %s", interval_params.Url)
+	}
+
+	if interval_params.FetchIntervalSeconds.Valid {
+		fmt.Printf("Feed %s will be fetched every %s\n", interval_params.Url, cmd.arguments[1])
+	} else {
+		fmt.Printf("Feed %s will be fetched on its own schedule\n", interval_params.Url)
+	}
+	return nil
+}
+
+func printFeedErrors(s *state) error {
+	feeds, err := s.db.GetFeedsWithErrors(context.Background())
+	if err != nil {
+		return fmt.Errorf("error retrieving failing feeds: %w", err)
+	}
+
+	if len(feeds) == 0 {
+		fmt.Println("No failing feeds.")
+		return nil
+	}
+
+	for _, feed := range feeds {
+		fmt.Printf("Feed name: %s\n", feed.Name)
+		fmt.Printf("URL: %s\n", feed.Url)
+		fmt.Printf("Failures in a row: %d\n", feed.ConsecutiveFailures)
+		if feed.LastErrorAt.Valid {
+			fmt.Printf("Last failed: %s\n", feed.LastErrorAt.Time.Format("Mon Jan 2 2006 15:04"))
+		}
+		fmt.Printf("Error: %s\n\n", feed.LastError.String)
+	}
+	return nil
+}
+
 func handerFollow(s *state, cmd command, user database.User) error {
 	if len(cmd.arguments) < 1 {
 		return fmt.Errorf("follow handler expects one argument (<url>); missing url ")
@@ -262,6 +511,19 @@ func handerFollow(s *state, cmd command, user database.User) error {
 	url := cmd.arguments[0]
 
 	feed_uuid, err := s.db.GetFeedIDbyURL(context.Background(), url)
+	if errors.Is(err, sql.ErrNoRows) {
+		// maybe it's the website rather than the feed url gator knows it by
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		defer cancel()
+		discovered, discoverErr := discoverFeed(ctx, url)
+		if discoverErr != nil {
+			return fmt.Errorf("feed %s not found; add it first with addfeed", url)
+		}
+		feed_uuid, err = s.db.GetFeedIDbyURL(context.Background(), discovered.URL)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("feed %s not found; add it first with addfeed", discovered.URL)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("error looking up feed id: %w", err)
 	}
@@ -309,11 +571,11 @@ func handlerFollowing(s *state, cmd command, user database.User) error { //
 		return fmt.Errorf("error retrieving feed follows: %w", err)
 	}
 	for _, feed := range feed_follows_list {
-		feed_name, err := s.db.GetFeedNameByUUID(context.Background(), feed.FeedID)
-		if err != nil {
-			return fmt.Errorf("error looking up feed name by id: %W", err)
+		if feed.Folder.Valid {
+			fmt.Printf("Feed name: %s (folder: %s)\n", feed.FeedName, feed.Folder.String)
+		} else {
+			fmt.Printf("Feed name: %s\n", feed.FeedName)
 		}
-		fmt.Printf("Feed name: %s\n", feed_name)
 	}
 	return nil
 }
@@ -338,6 +600,436 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 	return nil
 }
 
+func handlerBrowse(s *state, cmd command, user database.User) error {
+	browseFlags := flag.NewFlagSet("browse", flag.ContinueOnError)
+	category := browseFlags.String("category", "", "only show posts tagged with this category")
+	full := browseFlags.Bool("full", false, "show each post's full content instead of its summary")
+
+	arguments, err := parseFlags(browseFlags, cmd.arguments)
+	if err != nil || len(arguments) > 1 {
+		return fmt.Errorf("browse handler expects at most one argument [limit] [--category name] [--full]")
+	}
+
+	limit := 2 // default number of posts to show
+	if len(arguments) == 1 {
+		parsedLimit, err := strconv.Atoi(arguments[0])
+		if err != nil || parsedLimit < 1 {
+			return fmt.Errorf("browse limit must be a positive number, got: %s", arguments[0])
+		}
+		limit = parsedLimit
+	}
+
+	var browse_params database.GetPostsForUserParams
+	browse_params.UserID = user.ID
+	browse_params.Category = toNullString(strings.TrimSpace(*category))
+	browse_params.LimitPosts = int32(limit)
+
+	posts, err := s.db.GetPostsForUser(context.Background(), browse_params)
+	if err != nil {
+		return fmt.Errorf("error retrieving posts: %w", err)
+	}
+
+	if len(posts) == 0 {
+		if browse_params.Category.Valid {
+			fmt.Printf("No posts found in category %s.\n", browse_params.Category.String)
+			return nil
+		}
+		fmt.Println("No posts found; follow some feeds and run agg first.")
+		return nil
+	}
+
+	for _, post := range posts {
+		published := "unknown date"
+		if post.PublishedAt.Valid {
+			published = post.PublishedAt.Time.Format("Mon Jan 2 2006 15:04")
+		}
+		fmt.Printf("%s\n", post.Title)
+		fmt.Printf(" - Feed: %s\n", post.FeedName)
+		if post.Author.Valid {
+			fmt.Printf(" - Author: %s\n", post.Author.String)
+		}
+		fmt.Printf(" - Published: %s\n", published)
+		if len(post.Categories) > 0 {
+			fmt.Printf(" - Categories: %s\n", strings.Join(post.Categories, ", "))
+		}
+		if post.Url != "" {
+			fmt.Printf(" - Link: %s\n", post.Url)
+		}
+		if post.CommentsUrl.Valid {
+			fmt.Printf(" - Comments: %s\n", post.CommentsUrl.String)
+		}
+
+		enclosures, err := s.db.GetEnclosuresForPost(context.Background(), post.ID)
+		if err != nil {
+			return fmt.Errorf("error retrieving enclosures: %w", err)
+		}
+		for _, enclosure := range enclosures {
+			fmt.Printf(" - Attachment: %s%s\n", enclosure.Url, describeEnclosure(enclosure))
+		}
+
+		body := post.Description.String
+		if *full && post.Content.Valid {
+			body = post.Content.String
+		}
+		if text := renderHTMLText(body, htmlBaseURL(post.Url, post.FeedSiteUrl.String, post.FeedUrl), textWidth()); text != "" {
+			fmt.Printf("\n%s\n", text)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func handlerSearch(s *state, cmd command, user database.User) error {
+	searchFlags := flag.NewFlagSet("search", flag.ContinueOnError)
+	feedURL := searchFlags.String("feed", "", "only search posts of this feed (url)")
+	since := searchFlags.Duration("since", 0, "only search posts published within this long, e.g. 168h")
+	limit := searchFlags.Int("limit", 10, "number of results to show")
+
+	arguments, err := parseFlags(searchFlags, cmd.arguments)
+	if err != nil || len(arguments) == 0 {
+		return fmt.Errorf("search handler expects a query: <query> [--feed url] [--since duration] [--limit N]")
+	}
+	if *limit < 1 {
+		return fmt.Errorf("search limit must be a positive number, got: %d", *limit)
+	}
+
+	// the query reads like a web search: words, "quoted phrases", OR and -excluded words
+	var search_params database.SearchPostsForUserParams
+	search_params.Query = strings.Join(arguments, " ")
+	search_params.UserID = user.ID
+	search_params.FeedUrl = toNullString(*feedURL)
+	if *since > 0 {
+		// published dates are stored in UTC
+		search_params.Since = sql.NullTime{Time: time.Now().UTC().Add(-*since), Valid: true}
+	}
+	search_params.LimitPosts = int32(*limit)
+
+	results, err := s.db.SearchPostsForUser(context.Background(), search_params)
+	if err != nil {
+		return fmt.Errorf("error searching posts: %w", err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("No posts match %q.\n", search_params.Query)
+		return nil
+	}
+
+	for _, result := range results {
+		published := "unknown date"
+		if result.PublishedAt.Valid {
+			published = result.PublishedAt.Time.Format("Mon Jan 2 2006 15:04")
+		}
+		fmt.Printf("%s\n", result.Title)
+		fmt.Printf(" - Feed: %s\n", result.FeedName)
+		fmt.Printf(" - Published: %s\n", published)
+		if result.Url != "" {
+			fmt.Printf(" - Link: %s\n", result.Url)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// describeEnclosure gives an attachment's type and size, e.g. " (audio/mpeg, 24.1 MB)".
+func describeEnclosure(enclosure database.Enclosure) string {
+	var details []string
+	if enclosure.MimeType.Valid {
+		details = append(details, enclosure.MimeType.String)
+	}
+	if enclosure.Length.Valid {
+		details = append(details, fmt.Sprintf("%.1f MB", float64(enclosure.Length.Int64)/1e6))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+func handlerImportOPML(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("import-opml handler expects one argument <file>")
+	}
+
+	doc, err := readOPML(cmd.arguments[0])
+	if err != nil {
+		return fmt.Errorf("error reading opml file: %w", err)
+	}
+
+	var created, followed, skipped, failed int
+	for _, opmlFeed := range doc.feeds() {
+		feed_id, isNew, err := findOrCreateFeed(s, user, opmlFeed.Title, opmlFeed.XMLURL, opmlFeed.HTMLURL)
+		if err != nil {
+			fmt.Printf("failed to add feed %s: %v\n", opmlFeed.XMLURL, err)
+			failed++
+			continue
+		}
+		if isNew {
+			created++
+		}
+
+		var feed_follow_params database.CreateFeedFollowParams
+		feed_follow_params.FeedID = feed_id
+		feed_follow_params.UserID = user.ID
+		feed_follow_params.Folder = toNullString(opmlFeed.Folder)
+
+		_, err = s.db.CreateFeedFollow(context.Background(), feed_follow_params)
+		if isUniqueViolation(err) {
+			skipped++ // already following; re-running an import is harmless
+			continue
+		}
+		if err != nil {
+			fmt.Printf("failed to follow feed %s: %v\n", opmlFeed.XMLURL, err)
+			failed++
+			continue
+		}
+		followed++
+	}
+
+	fmt.Printf("Import finished: %d feeds created, %d followed, %d skipped, %d failed\n", created, followed, skipped, failed)
+	return nil
+}
+
+func handlerExportOPML(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) > 1 {
+		return fmt.Errorf("export-opml handler expects at most one argument [file]")
+	}
+
+	feed_follows_list, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("error retrieving feed follows: %w", err)
+	}
+
+	var feeds []opmlFeed
+	for _, follow := range feed_follows_list {
+		feeds = append(feeds, opmlFeed{
+			Title:   follow.FeedName,
+			XMLURL:  follow.FeedUrl,
+			HTMLURL: follow.FeedSiteUrl.String,
+			Folder:  follow.Folder.String,
+		})
+	}
+
+	out := os.Stdout
+	if len(cmd.arguments) == 1 {
+		file, err := os.Create(cmd.arguments[0])
+		if err != nil {
+			return fmt.Errorf("error creating opml file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	doc := newOPMLDocument(fmt.Sprintf("gator subscriptions for %s", user.Name), user.Name, feeds)
+	if err := writeOPML(out, doc); err != nil {
+		return fmt.Errorf("error writing opml: %w", err)
+	}
+
+	if out != os.Stdout {
+		fmt.Printf("Exported %d feeds to %s\n", len(feeds), cmd.arguments[0])
+	}
+	return nil
+}
+
+func handlerDownload(s *state, cmd command, user database.User) error {
+	downloadFlags := flag.NewFlagSet("download", flag.ContinueOnError)
+	feedURL := downloadFlags.String("feed", "", "only download episodes of this feed (url)")
+	since := downloadFlags.Duration("since", 0, "only download episodes published within this long, e.g. 168h")
+
+	arguments, err := parseFlags(downloadFlags, cmd.arguments)
+	if err != nil || len(arguments) != 0 {
+		return fmt.Errorf("download handler expects no arguments [--feed url] [--since duration]")
+	}
+
+	dir, err := s.appState.PodcastDir()
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	dir, err = filepath.Abs(dir) // mark-played looks downloads up by absolute path
+	if err != nil {
+		return err
+	}
+
+	var episode_params database.GetEpisodesForUserParams
+	episode_params.UserID = user.ID
+	episode_params.FeedUrl = toNullString(*feedURL)
+	if *since > 0 {
+		// published dates are stored in UTC
+		episode_params.Since = sql.NullTime{Time: time.Now().UTC().Add(-*since), Valid: true}
+	}
+	episode_params.OnlyMissing = true
+	episode_params.LimitEpisodes = maxEpisodes
+
+	episodes, err := s.db.GetEpisodesForUser(context.Background(), episode_params)
+	if err != nil {
+		return fmt.Errorf("error retrieving episodes: %w", err)
+	}
+	if len(episodes) == 0 {
+		fmt.Println("No new episodes to download.")
+		return nil
+	}
+
+	// ctrl-c leaves the current episode's .part file behind for the next run to resume
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	downloaded := 0
+	for _, episode := range episodes {
+		dest := episodePath(dir, episode)
+
+		result, found, err := existingDownload(s, episode, dest)
+		if err != nil {
+			return err
+		}
+		if !found {
+			fmt.Printf("Downloading %s - %s\n", episode.FeedName, episode.PostTitle)
+			result, err = downloadEnclosure(ctx, episode.Url, dest)
+			if err != nil && ctx.Err() != nil {
+				return fmt.Errorf("download interrupted; run download again to resume")
+			}
+			if err != nil {
+				log.Printf("error downloading %s: %v", episode.Url, err)
+				continue
+			}
+			if episode.Length.Valid && episode.Length.Int64 > 0 && episode.Length.Int64 != result.Size {
+				// feeds often get this wrong, so it's only worth a mention
+				log.Printf("note: %s is %d bytes, the feed said %d", result.Path, result.Size, episode.Length.Int64)
+			}
+		}
+
+		var downloaded_params database.MarkEpisodeDownloadedParams
+		downloaded_params.UserID = user.ID
+		downloaded_params.EnclosureID = episode.ID
+		downloaded_params.FilePath = toNullString(result.Path)
+		downloaded_params.FileSize = sql.NullInt64{Int64: result.Size, Valid: true}
+		downloaded_params.Sha256 = toNullString(result.SHA256)
+		err = s.db.MarkEpisodeDownloaded(context.Background(), downloaded_params)
+		if err != nil {
+			return fmt.Errorf("error recording download: %w", err)
+		}
+		fmt.Printf("Saved %s\n", result.Path)
+		downloaded++
+	}
+
+	fmt.Printf("Downloaded %d of %d episodes to %s\n", downloaded, len(episodes), dir)
+	return nil
+}
+
+func handlerPodcasts(s *state, cmd command, user database.User) error {
+	podcastsFlags := flag.NewFlagSet("podcasts", flag.ContinueOnError)
+	feedURL := podcastsFlags.String("feed", "", "only list episodes of this feed (url)")
+
+	arguments, err := parseFlags(podcastsFlags, cmd.arguments)
+	if err != nil || len(arguments) > 1 {
+		return fmt.Errorf("podcasts handler expects at most one argument [limit] [--feed url]")
+	}
+
+	limit := 10 // default number of episodes to list
+	if len(arguments) == 1 {
+		parsedLimit, err := strconv.Atoi(arguments[0])
+		if err != nil || parsedLimit < 1 {
+			return fmt.Errorf("podcasts limit must be a positive number, got: %s", arguments[0])
+		}
+		limit = min(parsedLimit, maxEpisodes)
+	}
+
+	var episode_params database.GetEpisodesForUserParams
+	episode_params.UserID = user.ID
+	episode_params.FeedUrl = toNullString(*feedURL)
+	episode_params.LimitEpisodes = int32(limit)
+
+	episodes, err := s.db.GetEpisodesForUser(context.Background(), episode_params)
+	if err != nil {
+		return fmt.Errorf("error retrieving episodes: %w", err)
+	}
+	if len(episodes) == 0 {
+		fmt.Println("No podcast episodes found; follow a podcast feed and run agg first.")
+		return nil
+	}
+
+	for _, episode := range episodes {
+		published := "unknown date"
+		if episode.PublishedAt.Valid {
+			published = episode.PublishedAt.Time.Format("Mon Jan 2 2006")
+		}
+
+		status := "not downloaded"
+		if episode.DownloadedAt.Valid {
+			status = "downloaded to " + episode.FilePath.String
+		}
+		if episode.PlayedAt.Valid {
+			status += ", played"
+		}
+
+		fmt.Printf("%s\n", episode.PostTitle)
+		fmt.Printf(" - Podcast: %s\n", episode.FeedName)
+		fmt.Printf(" - Published: %s\n", published)
+		fmt.Printf(" - Audio: %s\n", episode.Url)
+		fmt.Printf(" - Status: %s\n\n", status)
+	}
+	return nil
+}
+
+func handlerMarkPlayed(s *state, cmd command, user database.User) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("mark-played handler expects one argument <episode url | downloaded file>")
+	}
+
+	episode := cmd.arguments[0]
+	if _, err := os.Stat(episode); err == nil {
+		// downloads are recorded by absolute path
+		if absolute, err := filepath.Abs(episode); err == nil {
+			episode = absolute
+		}
+	}
+
+	var played_params database.MarkEpisodePlayedParams
+	played_params.UserID = user.ID
+	played_params.Episode = episode
+
+	marked, err := s.db.MarkEpisodePlayed(context.Background(), played_params)
+	if err != nil {
+		return fmt.Errorf("error marking episode played: %w", err)
+	}
+	if marked == 0 {
+		return fmt.Errorf("no episode found for %s", cmd.arguments[0])
+	}
+	fmt.Printf("Marked %s as played\n", cmd.arguments[0])
+	return nil
+}
+
+// findOrCreateFeed reuses the feed stored under url, or creates it owned by user.
+func findOrCreateFeed(s *state, user database.User, name string, url string, siteURL string) (uuid.UUID, bool, error) {
+	feed_id, err := s.db.GetFeedIDbyURL(context.Background(), url)
+	if err == nil {
+		return feed_id, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, false, err
+	}
+
+	var newFeed database.CreateFeedParams
+	newFeed.Name = name
+	if newFeed.Name == "" {
+		newFeed.Name = url
+	}
+	newFeed.Url = url
+	newFeed.CreatedAt = time.Now()
+	newFeed.UpdatedAt = time.Now()
+	newFeed.UserID = user.ID
+	newFeed.SiteUrl = toNullString(siteURL)
+
+	feed, err := s.db.CreateFeed(context.Background(), newFeed)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return feed.ID, true, nil
+}
+
+// isUniqueViolation reports whether err is postgres rejecting a duplicate row.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pq.ErrorCode("23505")
+}
+
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
 
 	return func(s *state, cmd command) error {
@@ -2,8 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 const configFileName = ".gatorconfig.json"
@@ -11,8 +14,46 @@ const configFileName = ".gatorconfig.json"
 type Config struct { // -export aconfig struct  representing json structure with tags
 	DbURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+
+	// optional bounds for adaptive polling, as duration strings ("15m", "24h")
+	MinFetchInterval string `json:"min_fetch_interval,omitempty"`
+	MaxFetchInterval string `json:"max_fetch_interval,omitempty"`
+
+	// optional number of failed fetches in a row after which a feed is disabled
+	MaxFeedFailures int `json:"max_feed_failures,omitempty"`
+
+	// optional limits on every http request gator makes; timeouts are duration strings
+	MaxFeedSize    int64  `json:"max_feed_size,omitempty"` // bytes
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+	ReadTimeout    string `json:"read_timeout,omitempty"`
+	MaxRedirects   int    `json:"max_redirects,omitempty"`
+
+	// optional directory podcast episodes are downloaded to; "~/" is the home directory
+	DownloadDir string `json:"download_dir,omitempty"`
 }
 
+// FetchLimits bounds what a single http request may cost.
+type FetchLimits struct {
+	MaxBodySize    int64         // largest response body read, in bytes
+	ConnectTimeout time.Duration // dialing and the TLS handshake
+	ReadTimeout    time.Duration // waiting for and reading the response
+	MaxRedirects   int
+}
+
+// defaults used when the config file doesn't set the bounds
+const (
+	DefaultMinFetchInterval = 15 * time.Minute
+	DefaultMaxFetchInterval = 24 * time.Hour
+	DefaultMaxFeedFailures  = 10
+
+	DefaultMaxFeedSize    = 10 << 20 // 10 MiB
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultReadTimeout    = 30 * time.Second
+	DefaultMaxRedirects   = 10
+
+	DefaultDownloadDir = "gator-podcasts" // inside the home directory
+)
+
 // export a "SetUser" method on the "Config" struct that writes the config struct to the  JSON file
 // after setting "current_user_name" field
 func (c *Config) SetUser(username string) error {
@@ -25,6 +66,91 @@ func (c *Config) SetUser(username string) error {
 	return nil
 }
 
+// FetchIntervalBounds returns how often (at most) and how rarely (at least) a feed
+// without a fixed interval gets polled.
+func (c Config) FetchIntervalBounds() (time.Duration, time.Duration, error) {
+	minInterval, maxInterval := DefaultMinFetchInterval, DefaultMaxFetchInterval
+
+	if c.MinFetchInterval != "" {
+		parsed, err := time.ParseDuration(c.MinFetchInterval)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid min_fetch_interval: %w", err)
+		}
+		minInterval = parsed
+	}
+	if c.MaxFetchInterval != "" {
+		parsed, err := time.ParseDuration(c.MaxFetchInterval)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid max_fetch_interval: %w", err)
+		}
+		maxInterval = parsed
+	}
+
+	if minInterval <= 0 || maxInterval < minInterval {
+		return 0, 0, fmt.Errorf("fetch interval bounds must satisfy 0 < min_fetch_interval <= max_fetch_interval")
+	}
+	return minInterval, maxInterval, nil
+}
+
+// FeedFailureLimit returns how many failed fetches in a row disable a feed.
+func (c Config) FeedFailureLimit() int {
+	if c.MaxFeedFailures > 0 {
+		return c.MaxFeedFailures
+	}
+	return DefaultMaxFeedFailures
+}
+
+// FetchLimits returns the configured http limits, with defaults for anything unset.
+func (c Config) FetchLimits() (FetchLimits, error) {
+	limits := FetchLimits{
+		MaxBodySize:    DefaultMaxFeedSize,
+		ConnectTimeout: DefaultConnectTimeout,
+		ReadTimeout:    DefaultReadTimeout,
+		MaxRedirects:   DefaultMaxRedirects,
+	}
+
+	if c.MaxFeedSize > 0 {
+		limits.MaxBodySize = c.MaxFeedSize
+	}
+	if c.MaxRedirects > 0 {
+		limits.MaxRedirects = c.MaxRedirects
+	}
+	if c.ConnectTimeout != "" {
+		parsed, err := time.ParseDuration(c.ConnectTimeout)
+		if err != nil || parsed <= 0 {
+			return FetchLimits{}, fmt.Errorf("invalid connect_timeout: %q", c.ConnectTimeout)
+		}
+		limits.ConnectTimeout = parsed
+	}
+	if c.ReadTimeout != "" {
+		parsed, err := time.ParseDuration(c.ReadTimeout)
+		if err != nil || parsed <= 0 {
+			return FetchLimits{}, fmt.Errorf("invalid read_timeout: %q", c.ReadTimeout)
+		}
+		limits.ReadTimeout = parsed
+	}
+	return limits, nil
+}
+
+// PodcastDir returns the directory downloaded podcast episodes go to.
+func (c Config) PodcastDir() (string, error) {
+	homePath, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case c.DownloadDir == "":
+		return filepath.Join(homePath, DefaultDownloadDir), nil
+	case c.DownloadDir == "~":
+		return homePath, nil
+	case strings.HasPrefix(c.DownloadDir, "~/"):
+		return filepath.Join(homePath, c.DownloadDir[2:]), nil
+	default:
+		return c.DownloadDir, nil
+	}
+}
+
 // export read function  reads the json file at ~/.gatorconfig.json returns Config struct
 
 func Read() (Config, error) {
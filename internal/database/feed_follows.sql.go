@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,15 +15,16 @@ import (
 
 const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
-    INSERT INTO feed_follows (user_id, feed_id)
+    INSERT INTO feed_follows (user_id, feed_id, folder)
     VALUES (
         $1,
-        $2
+        $2,
+        $3
     )
-    RETURNING id, created_at, updated_at, user_id, feed_id
+    RETURNING id, created_at, updated_at, user_id, feed_id, folder
 )
 SELECT
-    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id,
+    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id, inserted_feed_follow.folder,
     feeds.name AS feed_name,
     users.name AS user_name
 FROM inserted_feed_follow
@@ -35,6 +37,7 @@ INNER JOIN users
 type CreateFeedFollowParams struct {
 	UserID uuid.UUID
 	FeedID uuid.UUID
+	Folder sql.NullString
 }
 
 type CreateFeedFollowRow struct {
@@ -43,12 +46,13 @@ type CreateFeedFollowRow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
 	FeedName  string
 	UserName  string
 }
 
 func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowParams) (CreateFeedFollowRow, error) {
-	row := q.db.QueryRowContext(ctx, createFeedFollow, arg.UserID, arg.FeedID)
+	row := q.db.QueryRowContext(ctx, createFeedFollow, arg.UserID, arg.FeedID, arg.Folder)
 	var i CreateFeedFollowRow
 	err := row.Scan(
 		&i.ID,
@@ -56,6 +60,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.Folder,
 		&i.FeedName,
 		&i.UserName,
 	)
@@ -63,26 +68,45 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
-SELECT id, created_at, updated_at, user_id, feed_id
+SELECT feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feed_follows.folder, feeds.name AS feed_name, feeds.url AS feed_url, feeds.site_url AS feed_site_url
     FROM feed_follows
-    WHERE user_id = $1
+    INNER JOIN feeds
+        ON feeds.id = feed_follows.feed_id
+    WHERE feed_follows.user_id = $1
+    ORDER BY feed_follows.folder NULLS FIRST, feeds.name
 `
 
-func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]FeedFollow, error) {
+type GetFeedFollowsForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	FeedID      uuid.UUID
+	Folder      sql.NullString
+	FeedName    string
+	FeedUrl     string
+	FeedSiteUrl sql.NullString
+}
+
+func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
 	rows, err := q.db.QueryContext(ctx, getFeedFollowsForUser, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []FeedFollow
+	var items []GetFeedFollowsForUserRow
 	for rows.Next() {
-		var i FeedFollow
+		var i GetFeedFollowsForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Folder,
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.FeedSiteUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -97,6 +121,24 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	return items, nil
 }
 
+const mergeFeedFollows = `-- name: MergeFeedFollows :exec
+INSERT INTO feed_follows (user_id, feed_id, folder)
+    SELECT user_id, $1::uuid, folder
+        FROM feed_follows
+        WHERE feed_id = $2
+ON CONFLICT (user_id, feed_id) DO NOTHING
+`
+
+type MergeFeedFollowsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+func (q *Queries) MergeFeedFollows(ctx context.Context, arg MergeFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, mergeFeedFollows, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
+
 const unfollowFeedForUser = `-- name: UnfollowFeedForUser :exec
 DELETE FROM feed_follows
     WHERE user_id = $1 AND feed_id = $2
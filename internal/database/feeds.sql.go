@@ -7,21 +7,23 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (created_at, updated_at, name, url, user_id, site_url)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, consecutive_failures, last_error_at, site_url, fetch_interval_seconds, ttl_seconds, skip_hours, skip_days, next_fetch_at, adaptive_interval_seconds, disabled_at, previous_url
 `
 
 type CreateFeedParams struct {
@@ -30,6 +32,7 @@ type CreateFeedParams struct {
 	Name      string
 	Url       string
 	UserID    uuid.UUID
+	SiteUrl   sql.NullString
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -39,6 +42,7 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.SiteUrl,
 	)
 	var i Feed
 	err := row.Scan(
@@ -49,10 +53,100 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastErrorAt,
+		&i.SiteUrl,
+		&i.FetchIntervalSeconds,
+		&i.TtlSeconds,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.AdaptiveIntervalSeconds,
+		&i.DisabledAt,
+		&i.PreviousUrl,
 	)
 	return i, err
 }
 
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds
+    WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const enableFeed = `-- name: EnableFeed :execrows
+UPDATE feeds
+    SET updated_at = NOW(), disabled_at = NULL, consecutive_failures = 0, next_fetch_at = NULL
+    WHERE url = $1
+`
+
+func (q *Queries) EnableFeed(ctx context.Context, url string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableFeed, url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getDisabledFeeds = `-- name: GetDisabledFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, consecutive_failures, last_error_at, site_url, fetch_interval_seconds, ttl_seconds, skip_hours, skip_days, next_fetch_at, adaptive_interval_seconds, disabled_at, previous_url
+    FROM feeds
+    WHERE disabled_at IS NOT NULL
+    ORDER BY disabled_at DESC
+`
+
+func (q *Queries) GetDisabledFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getDisabledFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastErrorAt,
+			&i.SiteUrl,
+			&i.FetchIntervalSeconds,
+			&i.TtlSeconds,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.AdaptiveIntervalSeconds,
+			&i.DisabledAt,
+			&i.PreviousUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFeedIDbyURL = `-- name: GetFeedIDbyURL :one
 SELECT id
     FROM feeds
@@ -93,7 +187,7 @@ func (q *Queries) GetFeedNameByUUID(ctx context.Context, id uuid.UUID) (string,
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, consecutive_failures, last_error_at, site_url, fetch_interval_seconds, ttl_seconds, skip_hours, skip_days, next_fetch_at, adaptive_interval_seconds, disabled_at, previous_url
     FROM feeds
 `
 
@@ -114,6 +208,20 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastErrorAt,
+			&i.SiteUrl,
+			&i.FetchIntervalSeconds,
+			&i.TtlSeconds,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.AdaptiveIntervalSeconds,
+			&i.DisabledAt,
+			&i.PreviousUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -128,35 +236,235 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at
+const getFeedsWithErrors = `-- name: GetFeedsWithErrors :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, consecutive_failures, last_error_at, site_url, fetch_interval_seconds, ttl_seconds, skip_hours, skip_days, next_fetch_at, adaptive_interval_seconds, disabled_at, previous_url
     FROM feeds
-    ORDER BY   last_fetched_at ASC NULLS FIRST
-    LIMIT 1
+    WHERE consecutive_failures > 0
+    ORDER BY consecutive_failures DESC, last_error_at DESC
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+func (q *Queries) GetFeedsWithErrors(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsWithErrors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastErrorAt,
+			&i.SiteUrl,
+			&i.FetchIntervalSeconds,
+			&i.TtlSeconds,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.AdaptiveIntervalSeconds,
+			&i.DisabledAt,
+			&i.PreviousUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
+UPDATE feeds
+    SET updated_at = NOW(), last_fetched_at = NOW(),
+        next_fetch_at = NOW() + $1::integer * INTERVAL '1 second'
+    WHERE id IN (
+        SELECT id
+            FROM feeds
+            WHERE disabled_at IS NULL
+                AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+            ORDER BY last_fetched_at ASC NULLS FIRST
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, consecutive_failures, last_error_at, site_url, fetch_interval_seconds, ttl_seconds, skip_hours, skip_days, next_fetch_at, adaptive_interval_seconds, disabled_at, previous_url
+`
+
+type GetNextFeedsToFetchParams struct {
+	LeaseSeconds int32
+	MaxFeeds     int32
+}
+
+func (q *Queries) GetNextFeedsToFetch(ctx context.Context, arg GetNextFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, arg.LeaseSeconds, arg.MaxFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastErrorAt,
+			&i.SiteUrl,
+			&i.FetchIntervalSeconds,
+			&i.TtlSeconds,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.AdaptiveIntervalSeconds,
+			&i.DisabledAt,
+			&i.PreviousUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
-    SET updated_at = NOW(),last_fetched_at = NOW()
+    SET updated_at = NOW(),last_fetched_at = NOW(),
+        etag = $1, last_modified = $2, site_url = $3,
+        ttl_seconds = $4, skip_hours = $5, skip_days = $6,
+        adaptive_interval_seconds = $7,
+        next_fetch_at = NOW() + $8::integer * INTERVAL '1 second',
+        last_error = NULL, consecutive_failures = 0
+    WHERE id = $9
+`
+
+type MarkFeedFetchedParams struct {
+	Etag                    sql.NullString
+	LastModified            sql.NullString
+	SiteUrl                 sql.NullString
+	TtlSeconds              sql.NullInt32
+	SkipHours               int32
+	SkipDays                int32
+	AdaptiveIntervalSeconds sql.NullInt32
+	NextFetchDelay          int32
+	ID                      uuid.UUID
+}
+
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched,
+		arg.Etag,
+		arg.LastModified,
+		arg.SiteUrl,
+		arg.TtlSeconds,
+		arg.SkipHours,
+		arg.SkipDays,
+		arg.AdaptiveIntervalSeconds,
+		arg.NextFetchDelay,
+		arg.ID,
+	)
+	return err
+}
+
+const recordFeedError = `-- name: RecordFeedError :exec
+UPDATE feeds
+    SET updated_at = NOW(), last_error = $1, last_error_at = NOW(),
+        consecutive_failures = consecutive_failures + 1,
+        next_fetch_at = NOW() + $2::integer * INTERVAL '1 second',
+        disabled_at = CASE WHEN $3::boolean THEN NOW() ELSE disabled_at END
+    WHERE id = $4
+`
+
+type RecordFeedErrorParams struct {
+	LastError  sql.NullString
+	RetryDelay int32
+	Disable    bool
+	ID         uuid.UUID
+}
+
+func (q *Queries) RecordFeedError(ctx context.Context, arg RecordFeedErrorParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedError,
+		arg.LastError,
+		arg.RetryDelay,
+		arg.Disable,
+		arg.ID,
+	)
+	return err
+}
+
+const setFeedPreviousURL = `-- name: SetFeedPreviousURL :exec
+UPDATE feeds
+    SET updated_at = NOW(), previous_url = $2
     WHERE id = $1
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type SetFeedPreviousURLParams struct {
+	ID          uuid.UUID
+	PreviousUrl sql.NullString
+}
+
+func (q *Queries) SetFeedPreviousURL(ctx context.Context, arg SetFeedPreviousURLParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedPreviousURL, arg.ID, arg.PreviousUrl)
+	return err
+}
+
+const setFeedFetchInterval = `-- name: SetFeedFetchInterval :execrows
+UPDATE feeds
+    SET updated_at = NOW(), fetch_interval_seconds = $2, next_fetch_at = NULL
+    WHERE url = $1
+`
+
+type SetFeedFetchIntervalParams struct {
+	Url                  string
+	FetchIntervalSeconds sql.NullInt32
+}
+
+func (q *Queries) SetFeedFetchInterval(ctx context.Context, arg SetFeedFetchIntervalParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setFeedFetchInterval, arg.Url, arg.FetchIntervalSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :exec
+UPDATE feeds
+    SET updated_at = NOW(), previous_url = url, url = $2
+    WHERE id = $1
+`
+
+type UpdateFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedURL, arg.ID, arg.Url)
 	return err
 }
@@ -11,14 +11,46 @@ import (
 	"github.com/google/uuid"
 )
 
+type Enclosure struct {
+	ID       uuid.UUID
+	PostID   uuid.UUID
+	Url      string
+	MimeType sql.NullString
+	Length   sql.NullInt64
+}
+
+type EpisodeState struct {
+	UserID       uuid.UUID
+	EnclosureID  uuid.UUID
+	FilePath     sql.NullString
+	FileSize     sql.NullInt64
+	Sha256       sql.NullString
+	DownloadedAt sql.NullTime
+	PlayedAt     sql.NullTime
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                      uuid.UUID
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+	Name                    string
+	Url                     string
+	UserID                  uuid.UUID
+	LastFetchedAt           sql.NullTime
+	Etag                    sql.NullString
+	LastModified            sql.NullString
+	LastError               sql.NullString
+	ConsecutiveFailures     int32
+	LastErrorAt             sql.NullTime
+	SiteUrl                 sql.NullString
+	FetchIntervalSeconds    sql.NullInt32
+	TtlSeconds              sql.NullInt32
+	SkipHours               int32
+	SkipDays                int32
+	NextFetchAt             sql.NullTime
+	AdaptiveIntervalSeconds sql.NullInt32
+	DisabledAt              sql.NullTime
+	PreviousUrl             sql.NullString
 }
 
 type FeedFollow struct {
@@ -27,6 +59,24 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
+}
+
+type Post struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  sql.NullTime
+	FeedID       uuid.UUID
+	Guid         string
+	Content      sql.NullString
+	Author       sql.NullString
+	Categories   []string
+	CommentsUrl  sql.NullString
+	SearchVector interface{}
 }
 
 type User struct {
@@ -18,6 +18,13 @@ func main() {
 		fmt.Println("Error reading config: ", err)
 	}
 
+	fetchLimits, err := userConfig.FetchLimits()
+	if err != nil {
+		fmt.Println("Error reading config: ", err)
+		os.Exit(1)
+	}
+	configureFetching(fetchLimits)
+
 	// step 7:
 	db, err := sql.Open("postgres", userConfig.DbURL)
 	if err != nil {
@@ -33,7 +40,7 @@ func main() {
 		fmt.Println("Error reading config: ", err)
 	}
 	*/
-	gatorState := state{appState: &userConfig, db: dbQueries}
+	gatorState := state{appState: &userConfig, db: dbQueries, conn: db}
 
 	gatorCommands := commands{cliCommands: make(map[string]func(*state, command) error)}
 
@@ -44,9 +51,18 @@ func main() {
 	gatorCommands.register("agg", handlerAgg)
 	gatorCommands.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	gatorCommands.register("feeds", handlerFeeds)
+	gatorCommands.register("set-interval", handlerSetInterval)
+	gatorCommands.register("enable-feed", handlerEnableFeed)
 	gatorCommands.register("follow", middlewareLoggedIn(handerFollow))
 	gatorCommands.register("following", middlewareLoggedIn(handlerFollowing))
 	gatorCommands.register("unfollow", middlewareLoggedIn(handlerUnfollow))
+	gatorCommands.register("browse", middlewareLoggedIn(handlerBrowse))
+	gatorCommands.register("search", middlewareLoggedIn(handlerSearch))
+	gatorCommands.register("import-opml", middlewareLoggedIn(handlerImportOPML))
+	gatorCommands.register("export-opml", middlewareLoggedIn(handlerExportOPML))
+	gatorCommands.register("download", middlewareLoggedIn(handlerDownload))
+	gatorCommands.register("podcasts", middlewareLoggedIn(handlerPodcasts))
+	gatorCommands.register("mark-played", middlewareLoggedIn(handlerMarkPlayed))
 	gatorArgs := os.Args
 
 	if len(gatorArgs) < 2 {
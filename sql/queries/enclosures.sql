@@ -0,0 +1,15 @@
+-- name: GetEnclosuresForPost :many
+SELECT * FROM enclosures
+    WHERE post_id = $1
+    ORDER BY url;
+
+-- name: SaveEnclosure :exec
+INSERT INTO enclosures (post_id, url, mime_type, length)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (post_id, url) DO UPDATE
+    SET mime_type = EXCLUDED.mime_type, length = EXCLUDED.length;
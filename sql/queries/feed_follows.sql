@@ -1,9 +1,10 @@
 -- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
-    INSERT INTO feed_follows (user_id, feed_id)
+    INSERT INTO feed_follows (user_id, feed_id, folder)
     VALUES (
         $1,
-        $2
+        $2,
+        $3
     )
     RETURNING *
 )
@@ -19,11 +20,21 @@ INNER JOIN users
 
 
 -- name: GetFeedFollowsForUser :many
-SELECT *
+SELECT feed_follows.*, feeds.name AS feed_name, feeds.url AS feed_url, feeds.site_url AS feed_site_url
     FROM feed_follows
-    WHERE user_id = $1;
+    INNER JOIN feeds
+        ON feeds.id = feed_follows.feed_id
+    WHERE feed_follows.user_id = $1
+    ORDER BY feed_follows.folder NULLS FIRST, feeds.name;
 
 
+-- name: MergeFeedFollows :exec
+INSERT INTO feed_follows (user_id, feed_id, folder)
+    SELECT user_id, sqlc.arg(to_feed_id)::uuid, folder
+        FROM feed_follows
+        WHERE feed_id = sqlc.arg(from_feed_id)
+ON CONFLICT (user_id, feed_id) DO NOTHING;
+
 -- name: UnfollowFeedForUser :exec
 DELETE FROM feed_follows
     WHERE user_id = $1 AND feed_id = $2;
@@ -1,11 +1,12 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (created_at, updated_at, name, url, user_id)
+INSERT INTO feeds (created_at, updated_at, name, url, user_id, site_url)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6
 )
 RETURNING *;
 
@@ -31,11 +32,69 @@ SELECT name
 
 -- name: MarkFeedFetched :exec
 UPDATE feeds
-    SET updated_at = NOW(),last_fetched_at = NOW()
+    SET updated_at = NOW(),last_fetched_at = NOW(),
+        etag = sqlc.arg(etag), last_modified = sqlc.arg(last_modified), site_url = sqlc.arg(site_url),
+        ttl_seconds = sqlc.arg(ttl_seconds), skip_hours = sqlc.arg(skip_hours), skip_days = sqlc.arg(skip_days),
+        adaptive_interval_seconds = sqlc.arg(adaptive_interval_seconds),
+        next_fetch_at = NOW() + sqlc.arg(next_fetch_delay)::integer * INTERVAL '1 second',
+        last_error = NULL, consecutive_failures = 0
+    WHERE id = sqlc.arg(id);
+
+-- name: SetFeedFetchInterval :execrows
+UPDATE feeds
+    SET updated_at = NOW(), fetch_interval_seconds = $2, next_fetch_at = NULL
+    WHERE url = $1;
+
+-- name: RecordFeedError :exec
+UPDATE feeds
+    SET updated_at = NOW(), last_error = sqlc.arg(last_error), last_error_at = NOW(),
+        consecutive_failures = consecutive_failures + 1,
+        next_fetch_at = NOW() + sqlc.arg(retry_delay)::integer * INTERVAL '1 second',
+        disabled_at = CASE WHEN sqlc.arg(disable)::boolean THEN NOW() ELSE disabled_at END
+    WHERE id = sqlc.arg(id);
+
+-- name: UpdateFeedURL :exec
+UPDATE feeds
+    SET updated_at = NOW(), previous_url = url, url = $2
+    WHERE id = $1;
+
+-- name: SetFeedPreviousURL :exec
+UPDATE feeds
+    SET updated_at = NOW(), previous_url = $2
     WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
+-- name: DeleteFeed :exec
+DELETE FROM feeds
+    WHERE id = $1;
+
+-- name: GetDisabledFeeds :many
+SELECT *
+    FROM feeds
+    WHERE disabled_at IS NOT NULL
+    ORDER BY disabled_at DESC;
+
+-- name: EnableFeed :execrows
+UPDATE feeds
+    SET updated_at = NOW(), disabled_at = NULL, consecutive_failures = 0, next_fetch_at = NULL
+    WHERE url = $1;
+
+-- name: GetFeedsWithErrors :many
 SELECT *
     FROM feeds
-    ORDER BY   last_fetched_at ASC NULLS FIRST
-    LIMIT 1;
\ No newline at end of file
+    WHERE consecutive_failures > 0
+    ORDER BY consecutive_failures DESC, last_error_at DESC;
+
+-- name: GetNextFeedsToFetch :many
+UPDATE feeds
+    SET updated_at = NOW(), last_fetched_at = NOW(),
+        next_fetch_at = NOW() + sqlc.arg(lease_seconds)::integer * INTERVAL '1 second'
+    WHERE id IN (
+        SELECT id
+            FROM feeds
+            WHERE disabled_at IS NULL
+                AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+            ORDER BY last_fetched_at ASC NULLS FIRST
+            LIMIT sqlc.arg(max_feeds)
+            FOR UPDATE SKIP LOCKED
+    )
+    RETURNING *;
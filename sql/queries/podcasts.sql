@@ -0,0 +1,56 @@
+-- name: GetEpisodeDownload :one
+SELECT file_size, sha256 FROM episode_states
+    WHERE enclosure_id = $1 AND file_path = $2 AND downloaded_at IS NOT NULL
+    LIMIT 1;
+
+-- name: GetEpisodesForUser :many
+SELECT enclosures.id, enclosures.url, enclosures.mime_type, enclosures.length,
+        posts.title AS post_title, posts.published_at,
+        feeds.name AS feed_name, feeds.url AS feed_url,
+        episode_states.file_path, episode_states.downloaded_at, episode_states.played_at
+    FROM enclosures
+    INNER JOIN posts
+        ON posts.id = enclosures.post_id
+    INNER JOIN feeds
+        ON feeds.id = posts.feed_id
+    INNER JOIN feed_follows
+        ON feed_follows.feed_id = feeds.id
+    LEFT JOIN episode_states
+        ON episode_states.enclosure_id = enclosures.id AND episode_states.user_id = feed_follows.user_id
+    WHERE feed_follows.user_id = sqlc.arg(user_id)
+        AND (enclosures.mime_type IS NULL OR enclosures.mime_type LIKE 'audio/%' OR enclosures.mime_type LIKE 'video/%')
+        AND (sqlc.narg(feed_url)::text IS NULL OR feeds.url = sqlc.narg(feed_url))
+        AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since))
+        AND (NOT sqlc.arg(only_missing)::boolean OR episode_states.downloaded_at IS NULL)
+    ORDER BY COALESCE(posts.published_at, posts.created_at) DESC
+    LIMIT sqlc.arg(limit_episodes);
+
+-- name: MarkEpisodeDownloaded :exec
+INSERT INTO episode_states (user_id, enclosure_id, file_path, file_size, sha256, downloaded_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+)
+ON CONFLICT (user_id, enclosure_id) DO UPDATE
+    SET file_path = EXCLUDED.file_path,
+        file_size = EXCLUDED.file_size,
+        sha256 = EXCLUDED.sha256,
+        downloaded_at = EXCLUDED.downloaded_at;
+
+-- name: MarkEpisodePlayed :execrows
+INSERT INTO episode_states (user_id, enclosure_id, played_at)
+    SELECT sqlc.arg(user_id)::uuid, enclosures.id, NOW()
+        FROM enclosures
+        INNER JOIN posts
+            ON posts.id = enclosures.post_id
+        INNER JOIN feed_follows
+            ON feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = sqlc.arg(user_id)
+        LEFT JOIN episode_states
+            ON episode_states.enclosure_id = enclosures.id AND episode_states.user_id = sqlc.arg(user_id)
+        WHERE enclosures.url = sqlc.arg(episode) OR episode_states.file_path = sqlc.arg(episode)
+ON CONFLICT (user_id, enclosure_id) DO UPDATE
+    SET played_at = EXCLUDED.played_at;
@@ -0,0 +1,87 @@
+-- name: AdoptLegacyPostGUID :one
+UPDATE posts
+    SET guid = sqlc.arg(guid)
+    WHERE feed_id = sqlc.arg(feed_id) AND url = sqlc.arg(url) AND guid = url
+        AND NOT EXISTS (
+            SELECT 1 FROM posts taken
+                WHERE taken.feed_id = sqlc.arg(feed_id) AND taken.guid = sqlc.arg(guid)
+        )
+RETURNING id;
+
+-- name: DeletePost :exec
+DELETE FROM posts
+    WHERE id = $1;
+
+-- name: GetPostsForUser :many
+SELECT posts.id, posts.title, posts.url, posts.description, posts.content, posts.published_at, posts.author,
+        posts.categories, posts.comments_url, feeds.name AS feed_name, feeds.url AS feed_url,
+        feeds.site_url AS feed_site_url
+    FROM posts
+    INNER JOIN feed_follows
+        ON feed_follows.feed_id = posts.feed_id
+    INNER JOIN feeds
+        ON feeds.id = posts.feed_id
+    WHERE feed_follows.user_id = sqlc.arg(user_id)
+        AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+            SELECT 1 FROM unnest(posts.categories) AS category
+                WHERE lower(category) = lower(sqlc.narg(category))
+        ))
+    ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+    LIMIT sqlc.arg(limit_posts);
+
+-- name: MovePostsToFeed :exec
+UPDATE posts SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+    WHERE feed_id = sqlc.arg(from_feed_id)
+        AND NOT EXISTS (
+            SELECT 1 FROM posts AS kept
+                WHERE kept.feed_id = sqlc.arg(to_feed_id) AND kept.guid = posts.guid
+        );
+
+-- name: SearchPostsForUser :many
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name AS feed_name,
+        ts_rank(posts.search_vector, search_query) AS rank
+    FROM posts
+    INNER JOIN feed_follows
+        ON feed_follows.feed_id = posts.feed_id
+    INNER JOIN feeds
+        ON feeds.id = posts.feed_id
+    CROSS JOIN websearch_to_tsquery('english', sqlc.arg(query)::text) AS search_query
+    WHERE feed_follows.user_id = sqlc.arg(user_id)
+        AND posts.search_vector @@ search_query
+        AND (sqlc.narg(feed_url)::text IS NULL OR feeds.url = sqlc.narg(feed_url))
+        AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since))
+    ORDER BY rank DESC, COALESCE(posts.published_at, posts.created_at) DESC
+    LIMIT sqlc.arg(limit_posts);
+
+-- name: UpsertPost :one
+INSERT INTO posts (created_at, updated_at, title, url, description, published_at, feed_id, guid,
+        content, author, categories, comments_url)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+    SET updated_at = EXCLUDED.updated_at,
+        title = EXCLUDED.title,
+        url = EXCLUDED.url,
+        description = EXCLUDED.description,
+        published_at = COALESCE(EXCLUDED.published_at, posts.published_at),
+        content = EXCLUDED.content,
+        author = EXCLUDED.author,
+        categories = EXCLUDED.categories,
+        comments_url = EXCLUDED.comments_url
+    WHERE (posts.title, posts.url, posts.description, posts.published_at,
+            posts.content, posts.author, posts.categories, posts.comments_url)
+        IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.url, EXCLUDED.description, COALESCE(EXCLUDED.published_at, posts.published_at),
+            EXCLUDED.content, EXCLUDED.author, EXCLUDED.categories, EXCLUDED.comments_url)
+RETURNING id, (xmax = 0) AS inserted;
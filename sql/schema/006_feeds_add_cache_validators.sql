@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD etag TEXT DEFAULT NULL,
+    ADD last_modified TEXT DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN etag,
+    DROP COLUMN last_modified;
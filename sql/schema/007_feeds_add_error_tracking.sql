@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD last_error TEXT DEFAULT NULL,
+    ADD consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    ADD last_error_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN last_error,
+    DROP COLUMN consecutive_failures,
+    DROP COLUMN last_error_at;
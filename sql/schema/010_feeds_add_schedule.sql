@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD fetch_interval_seconds INTEGER DEFAULT NULL,
+    ADD ttl_seconds INTEGER DEFAULT NULL,
+    ADD skip_hours INTEGER NOT NULL DEFAULT 0,
+    ADD skip_days INTEGER NOT NULL DEFAULT 0,
+    ADD next_fetch_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN fetch_interval_seconds,
+    DROP COLUMN ttl_seconds,
+    DROP COLUMN skip_hours,
+    DROP COLUMN skip_days,
+    DROP COLUMN next_fetch_at;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD adaptive_interval_seconds INTEGER DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN adaptive_interval_seconds;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD disabled_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN disabled_at;
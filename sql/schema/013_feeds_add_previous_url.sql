@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+    ADD previous_url TEXT DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+    DROP COLUMN previous_url;
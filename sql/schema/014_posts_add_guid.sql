@@ -0,0 +1,22 @@
+-- +goose Up
+-- posts are identified by the feed's own id for them (guid, Atom id, ...) instead of
+-- their link, which some feeds reuse or leave out; existing posts keep their url as id
+ALTER TABLE posts
+    ADD guid TEXT;
+UPDATE posts
+    SET guid = url;
+ALTER TABLE posts
+    ALTER COLUMN guid SET NOT NULL,
+    DROP CONSTRAINT posts_url_key,
+    ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+DELETE FROM posts older
+    USING posts newer
+    WHERE older.url = newer.url AND (older.created_at, older.id) < (newer.created_at, newer.id);
+DELETE FROM posts
+    WHERE url = '';
+ALTER TABLE posts
+    DROP CONSTRAINT posts_feed_id_guid_key,
+    DROP COLUMN guid,
+    ADD CONSTRAINT posts_url_key UNIQUE (url);
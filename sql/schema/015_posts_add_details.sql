@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE posts
+    ADD content TEXT,
+    ADD author TEXT,
+    ADD categories TEXT[] NOT NULL DEFAULT '{}',
+    ADD comments_url TEXT;
+
+CREATE TABLE enclosures(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    post_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    mime_type TEXT,
+    length BIGINT,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    UNIQUE (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE enclosures;
+
+ALTER TABLE posts
+    DROP COLUMN content,
+    DROP COLUMN author,
+    DROP COLUMN categories,
+    DROP COLUMN comments_url;
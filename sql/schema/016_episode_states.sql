@@ -0,0 +1,17 @@
+-- +goose Up
+-- per-user podcast state for an enclosure: where it was downloaded to, and whether it was played
+CREATE TABLE episode_states(
+    user_id UUID NOT NULL,
+    enclosure_id UUID NOT NULL,
+    file_path TEXT,
+    file_size BIGINT,
+    sha256 TEXT,
+    downloaded_at TIMESTAMP,
+    played_at TIMESTAMP,
+    PRIMARY KEY (user_id, enclosure_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (enclosure_id) REFERENCES enclosures(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE episode_states;